@@ -13,15 +13,68 @@ type Brain interface{
     Generate(p string) (string, error)
 }
 
+//Placeholders like <email> are kept whole by ProcessRedacted
+var placeholder = regexp.MustCompile(`<[a-z]+>`)
+
 func ProcessString(rawString string) []string {
-	return regexp.MustCompile(`\b`).Split(strings.ToLower(rawString), -1)
+    return splitWords(strings.ToLower(rawString))
+}
+
+//ProcessRedacted is ProcessString for text that's been through a Redactor,
+//keeping the placeholders it leaves, like <email>, as single tokens
+func ProcessRedacted(rawString string) []string {
+    lowered := strings.ToLower(rawString)
+    locations := placeholder.FindAllStringIndex(lowered, -1)
+    if len(locations) == 0 {
+        return splitWords(lowered)
+    }
+
+    tokens := []string{}
+    start := 0
+    for _, location := range locations {
+        if location[0] > start {
+            tokens = append(tokens, splitWords(lowered[start:location[0]])...)
+        }
+        tokens = append(tokens, lowered[location[0]:location[1]])
+        start = location[1]
+    }
+    if start < len(lowered) {
+        tokens = append(tokens, splitWords(lowered[start:])...)
+    }
+    return tokens
+}
+
+func splitWords(s string) []string {
+	return regexp.MustCompile(`\b`).Split(s, -1)
 }
 
 func ExtractSubject(message []string, length int) []string {
+    return ExtractSubjectWithContext(message, []string{}, length)
+}
+
+//ExtractSubjectWithContext is ExtractSubject for a message that's part of a
+//conversation. Keywords the conversation has already mentioned are more
+//likely to be chosen, and if the message has no keywords of its own, the
+//subject is carried on from the context, padded with the words around it there.
+func ExtractSubjectWithContext(message []string, context []string, length int) []string {
     trimmedMessage := trimMessage(message)
+    trimmedContext := trimMessage(context)
     var subject string
     if len(trimmedMessage) > 0 {
-        subject = trimmedMessage[rand.Intn(len(trimmedMessage))]
+        candidates := trimmedMessage
+        for _, word := range trimmedMessage {
+            for _, contextWord := range trimmedContext {
+                if word == contextWord {
+                    candidates = append(candidates, word)
+                    break
+                }
+            }
+        }
+        subject = candidates[rand.Intn(len(candidates))]
+    } else if len(trimmedContext) > 0 {
+        //Keep the conversation going with something said earlier
+        subject = trimmedContext[rand.Intn(len(trimmedContext))]
+        message = context
     } else {
         //If there's nothing but stopwords, return nothing
         return []string{}
@@ -54,6 +107,12 @@ func ExtractSubject(message []string, length int) []string {
     return subjectWords
 }
 
+//Keywords returns the words in a processed message that could be its subject,
+//leaving out stopwords, punctuation and mentions
+func Keywords(message []string) []string {
+    return trimMessage(message)
+}
+
 func trimMessage(message []string) []string {
     trimmedMessage := []string{}
     for _, word := range message {
@@ -2,8 +2,10 @@ package brain
 
 
 import (
+	"fmt"
 	"testing"
 	"reflect"
+	"github.com/MattChubb/chatbrains/internal/benchdata"
 )
 
 func TestProcessString(t *testing.T) {
@@ -21,6 +23,7 @@ func TestProcessString(t *testing.T) {
 		{"Capitalisation", "Test. data,", []string{"test", ". ", "data", ","}},
 		{"Mixed Case", "Test. Data,", []string{"test", ". ", "data", ","}},
 		{"AlTeRnAtInG CaSe", "TeSt. DaTa,", []string{"test", ". ", "data", ","}},
+		{"Placeholder", "Mail <email> now", []string{"mail", " <", "email", "> ", "now"}},
 	}
 
 	for _, table := range tables {
@@ -34,6 +37,29 @@ func TestProcessString(t *testing.T) {
 	}
 }
 
+func TestProcessRedacted(t *testing.T) {
+	tables := []struct {
+		testcase string
+		input    string
+		expected []string
+	}{
+		{"No placeholders", "Test. Data,", []string{"test", ". ", "data", ","}},
+		{"Placeholder", "Mail <email> now", []string{"mail", " ", "<email>", " ", "now"}},
+		{"Placeholders only", "<phone><url>", []string{"<phone>", "<url>"}},
+		{"Not a placeholder", "a < b > c", []string{"a", " < ", "b", " > ", "c"}},
+	}
+
+	for _, table := range tables {
+		t.Logf("Testing: %s", table.testcase)
+		got := ProcessRedacted(table.input)
+		if !reflect.DeepEqual(got, table.expected) {
+			t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+		} else {
+			t.Log("Passed")
+		}
+	}
+}
+
 func TestExtractSubject(t *testing.T) {
 	tables := []struct {
 		testcase string
@@ -67,6 +93,42 @@ func TestExtractSubject(t *testing.T) {
 	}
 }
 
+func TestExtractSubjectWithContext(t *testing.T) {
+	tables := []struct {
+		testcase string
+		input    []string
+		context  []string
+		length   int
+		expected []string
+	}{
+		{"No context", []string{"test"}, []string{}, 1, []string{"test"}},
+		{"Unrelated context", []string{"test"}, []string{"data"}, 1, []string{"test"}},
+		{"Nothing but stopwords", []string{"the", " ", "and"}, []string{"data"}, 1, []string{"data"}},
+		{"Nothing but stopwords, order 2", []string{"the"}, []string{"the", " ", "data"}, 2, []string{" ", "data"}},
+		{"Nothing but stopwords, order 3", []string{"the"}, []string{"the", " ", "data", "."}, 3, []string{" ", "data", "."}},
+		{"Nothing at all", []string{"the"}, []string{"the"}, 1, []string{}},
+	}
+
+	for _, table := range tables {
+		t.Logf("Testing: %s", table.testcase)
+		got := ExtractSubjectWithContext(table.input, table.context, table.length)
+		if !reflect.DeepEqual(got, table.expected) {
+			t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+		} else {
+			t.Log("Passed")
+		}
+	}
+
+	//Words mentioned earlier in the conversation should be picked more often
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[ExtractSubjectWithContext([]string{"test", " ", "data"}, []string{"data"}, 1)[0]]++
+	}
+	if counts["data"] <= counts["test"] {
+		t.Errorf("FAIL, expected data to be picked more often than test, got: %#v", counts)
+	}
+}
+
 func TestTrimMessage(t *testing.T){
 	tables := []struct {
 		testcase string
@@ -110,3 +172,25 @@ func TestIsStopWord(t *testing.T){
 		}
 	}
 }
+
+func BenchmarkProcessString(b *testing.B) {
+    messages := benchdata.Realistic(b)
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        ProcessString(messages[i%len(messages)])
+    }
+}
+
+func BenchmarkExtractSubject(b *testing.B) {
+    messages := [][]string{}
+    for _, message := range benchdata.Realistic(b) {
+        messages = append(messages, ProcessString(message))
+    }
+    for _, length := range []int{1, 2, 3, 4} {
+        b.Run(fmt.Sprintf("length-%d", length), func(b *testing.B) {
+            for i := 0; i < b.N; i++ {
+                ExtractSubject(messages[i%len(messages)], length)
+            }
+        })
+    }
+}
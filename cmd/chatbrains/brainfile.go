@@ -0,0 +1,130 @@
+package main
+
+import (
+    "compress/gzip"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    chatbrains "github.com/MattChubb/chatbrains"
+    doublemarkov "github.com/MattChubb/chatbrains/doublemarkov"
+    markov "github.com/MattChubb/chatbrains/markov"
+)
+
+//brain is what the tool needs from a brain, which both markov and
+//doublemarkov brains provide
+type brain interface {
+    chatbrains.Brain
+    json.Marshaler
+    Load(r io.Reader) error
+    TrainFrom(r io.Reader, format chatbrains.Format, progress func(chatbrains.TrainStats)) (chatbrains.TrainStats, error)
+    GenerateDetailed(prompt string) (chatbrains.Reply, error)
+    Explain(prompt string) (chatbrains.Reply, error)
+}
+
+var brainTypes = map[string]func() brain{
+    "markov":       func() brain { return new(markov.Brain) },
+    "doublemarkov": func() brain { return new(doublemarkov.Brain) },
+}
+
+func typeNames() string {
+    names := make([]string, 0, len(brainTypes))
+    for name := range brainTypes {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return strings.Join(names, ", ")
+}
+
+//brainFlags adds the flags every command uses to pick a brain file and its type
+func brainFlags(flags *flag.FlagSet) (path *string, kind *string) {
+    path = flags.String("brain", "brain.json", "brain file, gzipped if it ends in .gz")
+    kind = flags.String("type", "markov", "brain type: "+typeNames())
+    return path, kind
+}
+
+func newBrain(kind string) (brain, error) {
+    create, ok := brainTypes[kind]
+    if !ok {
+        return nil, fmt.Errorf("Unknown brain type %q, expected one of: %s", kind, typeNames())
+    }
+    return create(), nil
+}
+
+//compressed is whether a brain file is gzipped
+func compressed(path string) bool {
+    return strings.HasSuffix(path, ".gz")
+}
+
+//loadBrain reads a brain of the given type from path
+func loadBrain(path string, kind string) (brain, error) {
+    b, err := newBrain(kind)
+    if err != nil {
+        return nil, err
+    }
+
+    f, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    var r io.Reader = f
+    if compressed(path) {
+        gz, err := gzip.NewReader(f)
+        if err != nil {
+            return nil, fmt.Errorf("Unable to load %s: %v", path, err)
+        }
+        defer gz.Close()
+        r = gz
+    }
+    if err := b.Load(r); err != nil {
+        return nil, fmt.Errorf("Unable to load %s: %v", path, err)
+    }
+    return b, nil
+}
+
+//saveBrain writes b to path, replacing it only once it's been written in full
+//so that a failed save never loses the previous brain
+func saveBrain(b brain, path string) (err error) {
+    data, err := b.MarshalJSON()
+    if err != nil {
+        return fmt.Errorf("Unable to save %s: %v", path, err)
+    }
+
+    f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+    if err != nil {
+        return err
+    }
+    defer func() {
+        if err != nil {
+            f.Close()
+            os.Remove(f.Name())
+            err = fmt.Errorf("Unable to save %s: %v", path, err)
+        }
+    }()
+
+    if compressed(path) {
+        gz := gzip.NewWriter(f)
+        if _, err := gz.Write(data); err != nil {
+            return err
+        }
+        if err := gz.Close(); err != nil {
+            return err
+        }
+    } else if _, err := f.Write(data); err != nil {
+        return err
+    }
+    if err := f.Chmod(0644); err != nil {
+        return err
+    }
+    if err := f.Close(); err != nil {
+        return err
+    }
+    return os.Rename(f.Name(), path)
+}
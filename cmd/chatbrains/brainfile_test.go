@@ -0,0 +1,98 @@
+package main
+
+import (
+    "bytes"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+    dir, err := ioutil.TempDir("", "chatbrains")
+    if err != nil {
+        t.Fatalf("FAIL, unable to create temp dir: %v", err)
+    }
+    defer os.RemoveAll(dir)
+
+    tables := []struct {
+        testcase string
+        kind     string
+        file     string
+    }{
+        {"markov, JSON", "markov", "brain.json"},
+        {"markov, gzipped", "markov", "brain.json.gz"},
+        {"doublemarkov, JSON", "doublemarkov", "double.json"},
+        {"doublemarkov, gzipped", "doublemarkov", "double.json.gz"},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        path := filepath.Join(dir, table.file)
+        b, err := newBrain(table.kind)
+        if err != nil {
+            t.Fatalf("FAIL, unexpected error: %v", err)
+        }
+        b.Init(1, 30)
+        b.Train("test data")
+
+        if err := saveBrain(b, path); err != nil {
+            t.Errorf("FAIL, unable to save: %v", err)
+            continue
+        }
+        loaded, err := loadBrain(path, table.kind)
+        if err != nil {
+            t.Errorf("FAIL, unable to load: %v", err)
+            continue
+        }
+
+        saved, _ := b.MarshalJSON()
+        got, _ := loaded.MarshalJSON()
+        if !bytes.Equal(saved, got) {
+            t.Errorf("FAIL, loaded brain differs from the saved one")
+        } else {
+            t.Log("Passed")
+        }
+    }
+
+    files, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+    if len(files) > 0 {
+        t.Errorf("FAIL, temporary files left behind: %v", files)
+    }
+}
+
+func TestLoadBrainErrors(t *testing.T) {
+    dir, err := ioutil.TempDir("", "chatbrains")
+    if err != nil {
+        t.Fatalf("FAIL, unable to create temp dir: %v", err)
+    }
+    defer os.RemoveAll(dir)
+    invalid := filepath.Join(dir, "invalid.json.gz")
+    ioutil.WriteFile(invalid, []byte("{}"), 0644)
+    markovBrain := filepath.Join(dir, "markov.json")
+    b, _ := newBrain("markov")
+    b.Init(1, 30)
+    saveBrain(b, markovBrain)
+    empty := filepath.Join(dir, "empty.json")
+    ioutil.WriteFile(empty, []byte("{}"), 0644)
+
+    tables := []struct {
+        testcase string
+        path     string
+        kind     string
+    }{
+        {"Unknown type", filepath.Join(dir, "brain.json"), "unknown"},
+        {"Missing file", filepath.Join(dir, "missing.json"), "markov"},
+        {"Not gzipped", invalid, "markov"},
+        {"Wrong type", markovBrain, "doublemarkov"},
+        {"Empty brain", empty, "markov"},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        if _, err := loadBrain(table.path, table.kind); err == nil {
+            t.Errorf("FAIL, expected an error")
+        } else {
+            t.Logf("Passed (%v)", err)
+        }
+    }
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+)
+
+//convert re-saves a brain under another name, which converts between plain
+//and gzipped JSON according to the names' extensions
+func convert(args []string, env env) error {
+    flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+    flags.SetOutput(env.stderr)
+    flags.Usage = func() {
+        fmt.Fprintln(env.stderr, "Usage: chatbrains convert [flags] <from> <to>\n\nSaves a brain in another format, gzipped if <to> ends in .gz.")
+        flags.PrintDefaults()
+    }
+    kind := flags.String("type", "markov", "brain type: "+typeNames())
+    if err := parse(flags, args); err != nil {
+        return err
+    }
+    if flags.NArg() != 2 {
+        flags.Usage()
+        return errUsage
+    }
+
+    b, err := loadBrain(flags.Arg(0), *kind)
+    if err != nil {
+        return err
+    }
+    return saveBrain(b, flags.Arg(1))
+}
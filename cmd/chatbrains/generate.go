@@ -0,0 +1,53 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "math/rand"
+    "strings"
+)
+
+//generate prints replies to the prompt given as arguments
+func generate(args []string, env env) error {
+    flags := flag.NewFlagSet("generate", flag.ContinueOnError)
+    flags.SetOutput(env.stderr)
+    flags.Usage = func() {
+        fmt.Fprintln(env.stderr, "Usage: chatbrains generate [flags] [prompt...]\n\nPrints replies to the prompt, one per line.")
+        flags.PrintDefaults()
+    }
+    path, kind := brainFlags(flags)
+    seed := seedFlag(flags)
+    count := flags.Int("count", 1, "how many replies to generate")
+    if err := parse(flags, args); err != nil {
+        return err
+    }
+
+    b, err := loadBrain(*path, *kind)
+    if err != nil {
+        return err
+    }
+    seed()
+
+    prompt := strings.Join(flags.Args(), " ")
+    for i := 0; i < *count; i++ {
+        reply, err := b.Generate(prompt)
+        if err != nil {
+            return err
+        }
+        fmt.Fprintln(env.stdout, reply)
+    }
+    return nil
+}
+
+//seedFlag adds a flag for seeding generation, returning a function that
+//seeds math/rand with it if it was set. Without a seed, replies are random.
+func seedFlag(flags *flag.FlagSet) func() {
+    seed := flags.Int64("seed", 0, "seed for repeatable replies")
+    return func() {
+        flags.Visit(func(f *flag.Flag) {
+            if f.Name == "seed" {
+                rand.Seed(*seed)
+            }
+        })
+    }
+}
@@ -0,0 +1,118 @@
+//Command chatbrains trains, generates from and inspects brains saved to disk,
+//without having to write a program of your own
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    log "github.com/sirupsen/logrus"
+)
+
+const usage = `Usage: chatbrains [-v] <command> [flags]
+
+Commands:
+%s
+Brains are saved as JSON, gzipped if the file name ends in .gz.
+Run "chatbrains <command> -h" for a command's flags.
+`
+
+//env is where a command reads and writes, so that it can be tested
+type env struct {
+    stdin  io.Reader
+    stdout io.Writer
+    stderr io.Writer
+}
+
+type command struct {
+    summary string
+    run     func(args []string, env env) error
+}
+
+var commands = map[string]command{
+    "train":    {"train a brain from files or stdin, creating it if needed", train},
+    "generate": {"generate replies to a prompt", generate},
+    "stats":    {"describe what a brain has learned", stats},
+    "convert":  {"save a brain in another format", convert},
+    "repl":     {"chat with a brain interactively", repl},
+}
+
+//errUsage is returned by commands given bad arguments, once the flag package
+//has already explained what was wrong
+var errUsage = errors.New("Bad usage")
+
+func main() {
+    os.Exit(run(os.Args[1:], env{os.Stdin, os.Stdout, os.Stderr}))
+}
+
+//run runs the command in args, returning the exit code
+func run(args []string, env env) int {
+    flags := flag.NewFlagSet("chatbrains", flag.ContinueOnError)
+    flags.SetOutput(env.stderr)
+    flags.Usage = func() { printUsage(env.stderr) }
+    verbose := flags.Bool("v", false, "log debugging output")
+    if err := parse(flags, args); err != nil {
+        return exitCode(err)
+    }
+
+    log.SetOutput(env.stderr)
+    log.SetLevel(log.WarnLevel)
+    if *verbose {
+        log.SetLevel(log.DebugLevel)
+    }
+
+    if flags.NArg() == 0 {
+        printUsage(env.stderr)
+        return 2
+    }
+    cmd, ok := commands[flags.Arg(0)]
+    if !ok {
+        fmt.Fprintf(env.stderr, "Unknown command %q\n\n", flags.Arg(0))
+        printUsage(env.stderr)
+        return 2
+    }
+    if err := cmd.run(flags.Args()[1:], env); err != nil {
+        if err != errUsage && err != flag.ErrHelp {
+            fmt.Fprintln(env.stderr, err)
+        }
+        return exitCode(err)
+    }
+    return 0
+}
+
+func exitCode(err error) int {
+    switch err {
+    case flag.ErrHelp:
+        return 0
+    case errUsage:
+        return 2
+    default:
+        return 1
+    }
+}
+
+func printUsage(w io.Writer) {
+    names := make([]string, 0, len(commands))
+    for name := range commands {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    list := ""
+    for _, name := range names {
+        list += fmt.Sprintf("  %-9s %s\n", name, commands[name].summary)
+    }
+    fmt.Fprintf(w, usage, list)
+}
+
+//parse parses flags, replacing errors with errUsage as the flag package has
+//already reported them
+func parse(flags *flag.FlagSet, args []string) error {
+    err := flags.Parse(args)
+    if err == nil || err == flag.ErrHelp {
+        return err
+    }
+    return errUsage
+}
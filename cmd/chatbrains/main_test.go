@@ -0,0 +1,174 @@
+package main
+
+import (
+    "bytes"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "regexp"
+    "strings"
+    "testing"
+)
+
+//runCommand runs the tool with args and stdin, returning its exit code and output
+func runCommand(stdin string, args ...string) (int, string, string) {
+    var stdout, stderr bytes.Buffer
+    code := run(args, env{strings.NewReader(stdin), &stdout, &stderr})
+    return code, stdout.String(), stderr.String()
+}
+
+func tempDir(t *testing.T) string {
+    dir, err := ioutil.TempDir("", "chatbrains")
+    if err != nil {
+        t.Fatalf("FAIL, unable to create temp dir: %v", err)
+    }
+    return dir
+}
+
+func TestRun(t *testing.T) {
+    tables := []struct {
+        testcase string
+        args     []string
+        code     int
+        stderr   string
+    }{
+        {"No command", []string{}, 2, "Commands:"},
+        {"Unknown command", []string{"unknown"}, 2, `Unknown command "unknown"`},
+        {"Help", []string{"-h"}, 0, "Commands:"},
+        {"Command help", []string{"generate", "-h"}, 0, "-seed"},
+        {"Unknown flag", []string{"generate", "-unknown"}, 2, "-unknown"},
+        {"Missing brain", []string{"generate", "-brain", "missing.json"}, 1, "missing.json"},
+        {"Unknown type", []string{"stats", "-type", "unknown"}, 1, `Unknown brain type "unknown"`},
+        {"Convert arguments", []string{"convert", "brain.json"}, 2, "<from> <to>"},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        code, _, stderr := runCommand("", table.args...)
+        if code != table.code {
+            t.Errorf("FAIL, expected exit code %d, got: %d", table.code, code)
+        } else if !strings.Contains(stderr, table.stderr) {
+            t.Errorf("FAIL, expected %#v in: %s", table.stderr, stderr)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestCommands(t *testing.T) {
+    dir := tempDir(t)
+    defer os.RemoveAll(dir)
+    corpus := filepath.Join(dir, "corpus.txt")
+    ioutil.WriteFile(corpus, []byte("test data\ndata test\n\n"), 0644)
+
+    for _, kind := range []string{"markov", "doublemarkov"} {
+        t.Logf("Testing: %s", kind)
+        brain := filepath.Join(dir, kind+".json")
+
+        code, stdout, stderr := runCommand("test node\n", "train", "-brain", brain, "-type", kind, corpus, "-")
+        if code != 0 || stdout != "Trained on 3 messages (9 tokens), skipped 1\n" {
+            t.Errorf("FAIL, unexpected train output: %d, %#v, %#v", code, stdout, stderr)
+        }
+
+        generate := []string{"generate", "-brain", brain, "-type", kind, "-seed", "1", "-count", "5", "test"}
+        code, first, stderr := runCommand("", generate...)
+        if code != 0 || strings.Count(first, "\n") != 5 {
+            t.Errorf("FAIL, expected 5 replies, got: %d, %#v, %#v", code, first, stderr)
+        }
+        if _, second, _ := runCommand("", generate...); second != first {
+            t.Errorf("FAIL, expected the same replies with the same seed, got: %#v and %#v", first, second)
+        }
+
+        code, stdout, stderr = runCommand("", "stats", "-brain", brain, "-type", kind)
+        if code != 0 || !strings.Contains(stdout, "Vocabulary:     4") {
+            t.Errorf("FAIL, expected a vocabulary of 4, got: %d, %#v, %#v", code, stdout, stderr)
+        }
+        code, stdout, stderr = runCommand("", "stats", "-brain", brain, "-type", kind, "-top", "1")
+        if match, _ := regexp.MatchString(`Top tokens:\n[^\n]*\nTop n-grams:\n[^\n]*\n(\n|$)`, stdout); code != 0 || !match {
+            t.Errorf("FAIL, expected only the top token and n-gram, got: %d, %#v, %#v", code, stdout, stderr)
+        }
+
+        converted := brain + ".gz"
+        if code, _, stderr = runCommand("", "convert", "-type", kind, brain, converted); code != 0 {
+            t.Errorf("FAIL, unable to convert: %s", stderr)
+        }
+        code, stdout, _ = runCommand("", "stats", "-brain", converted, "-type", kind, "-json")
+        if code != 0 || !strings.Contains(stdout, `"Vocabulary": 4`) {
+            t.Errorf("FAIL, expected the converted brain's stats, got: %d, %#v", code, stdout)
+        }
+
+        code, stdout, stderr = runCommand("test\n\ndata\n", "repl", "-brain", converted, "-type", kind)
+        if code != 0 || strings.Count(stdout, "> ") != 4 || strings.Count(stdout, "\n") != 3 {
+            t.Errorf("FAIL, expected 2 replies, got: %d, %#v, %#v", code, stdout, stderr)
+        }
+    }
+}
+
+func TestREPL(t *testing.T) {
+    dir := tempDir(t)
+    defer os.RemoveAll(dir)
+    brain := filepath.Join(dir, "brain.json")
+    saved := filepath.Join(dir, "saved.json")
+    runCommand("test data\ndata test\n", "train", "-brain", brain)
+
+    tables := []struct {
+        testcase string
+        args     []string
+        input    string
+        expected []string
+    }{
+        {"Help", []string{}, ":help\n", []string{":seed <n>", ":explain <prompt>", ":stats", ":save [file]", ":learn [on|off]"}},
+        {"Unknown command", []string{}, ":unknown\n", []string{`Error: Unknown command ":unknown"`}},
+        {"Bad seed", []string{}, ":seed x\n", []string{`Error: Expected a number to seed with, got "x"`}},
+        {"Explain", []string{}, ":explain test\n", []string{"Context", `"test"`, "Stopped: end"}},
+        {"Stats", []string{}, ":stats\n", []string{"Vocabulary:     3"}},
+        {"Bad stats", []string{}, ":stats x\n", []string{`Error: Expected a number of top tokens to list, got "x"`}},
+        {"Not learning", []string{}, "node\n:stats\n", []string{"Vocabulary:     3"}},
+        {"Learning", []string{"-learn"}, "node\n:stats\n", []string{"Vocabulary:     4", "Learned prompts weren't saved"}},
+        {"Learning toggled", []string{}, ":learn\nnode\n:learn off\nnode two\n:stats\n", []string{"Learning from prompts", "Not learning from prompts", "Vocabulary:     4"}},
+        {"Bad toggle", []string{}, ":learn maybe\n", []string{`Error: Expected on or off, got "maybe"`}},
+        {"Save", []string{"-learn"}, "node\n:save " + saved + "\n", []string{"Saved to " + saved}},
+        {"Quit", []string{}, ":quit\n:unknown\n", []string{}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        args := append([]string{"repl", "-brain", brain}, table.args...)
+        code, stdout, stderr := runCommand(table.input, args...)
+        if code != 0 {
+            t.Errorf("FAIL, unexpected exit code %d: %s", code, stderr)
+            continue
+        }
+        for _, expected := range table.expected {
+            if !strings.Contains(stdout, expected) {
+                t.Errorf("FAIL, expected %#v in: %s", expected, stdout)
+            }
+        }
+        if strings.Contains(stdout, "Error") && !strings.HasPrefix(table.testcase, "Bad") && !strings.HasPrefix(table.testcase, "Unknown") {
+            t.Errorf("FAIL, unexpected error in: %s", stdout)
+        }
+    }
+
+    //Only the brain saved to, not the original, should have learned
+    for path, vocabulary := range map[string]string{brain: "Vocabulary:     3", saved: "Vocabulary:     4"} {
+        if _, stdout, _ := runCommand("", "stats", "-brain", path); !strings.Contains(stdout, vocabulary) {
+            t.Errorf("FAIL, expected %#v for %s, got: %s", vocabulary, path, stdout)
+        }
+    }
+}
+
+func TestREPLSeed(t *testing.T) {
+    dir := tempDir(t)
+    defer os.RemoveAll(dir)
+    brain := filepath.Join(dir, "brain.json")
+    runCommand("test data\ndata test\ntest node data\n", "train", "-brain", brain)
+
+    input := ":seed 1\ntest\ntest\ntest\n"
+    _, first, _ := runCommand(input+input, "repl", "-brain", brain)
+    replies := strings.Split(first, "> ")
+    //The prompt before each line, then the reply to each of 3 prompts and
+    //the seed, twice over
+    if len(replies) != 10 || strings.Join(replies[1:5], "") != strings.Join(replies[5:9], "") {
+        t.Errorf("FAIL, expected the same replies after seeding again, got: %#v", replies)
+    }
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+    "bufio"
+    "errors"
+    "flag"
+    "fmt"
+    "io"
+    "math/rand"
+    "sort"
+    "strconv"
+    "strings"
+    "github.com/MattChubb/chatbrains/markovchain"
+)
+
+//session is the state of a REPL
+type session struct {
+    brain brain
+    path  string
+    out   io.Writer
+    //learn is whether prompts are trained into the brain, and unsaved
+    //whether that's changed it since it was last saved
+    learn   bool
+    unsaved bool
+}
+
+type replCommand struct {
+    usage   string
+    summary string
+    run     func(s *session, arg string) error
+}
+
+var replCommands map[string]replCommand
+
+//errQuit ends the REPL
+var errQuit = errors.New("Quit")
+
+func init() {
+    //Set here as :help refers to replCommands itself
+    replCommands = map[string]replCommand{
+        "help":    {":help", "list commands", (*session).help},
+        "seed":    {":seed <n>", "seed generation, for repeatable replies", (*session).seed},
+        "explain": {":explain <prompt>", "reply, showing how each word was chosen", (*session).explain},
+        "stats":   {":stats [top]", "describe what the brain has learned", (*session).stats},
+        "learn":   {":learn [on|off]", "toggle training on prompts", (*session).toggleLearn},
+        "save":    {":save [file]", "save the brain, to its own file by default", (*session).save},
+        "quit":    {":quit", "leave, as does the end of input", (*session).quit},
+    }
+}
+
+//repl replies to each line typed until stdin ends, running any that start
+//with : as commands
+func repl(args []string, env env) error {
+    flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+    flags.SetOutput(env.stderr)
+    flags.Usage = func() {
+        fmt.Fprintln(env.stderr, "Usage: chatbrains repl [flags]\n\nReplies to each line typed, until the end of input. Type :help for commands.")
+        flags.PrintDefaults()
+    }
+    path, kind := brainFlags(flags)
+    seed := seedFlag(flags)
+    learn := flags.Bool("learn", false, "train the brain on every prompt")
+    if err := parse(flags, args); err != nil {
+        return err
+    }
+
+    b, err := loadBrain(*path, *kind)
+    if err != nil {
+        return err
+    }
+    seed()
+
+    s := &session{brain: b, path: *path, out: env.stdout, learn: *learn}
+    scanner := bufio.NewScanner(env.stdin)
+    for fmt.Fprint(env.stdout, "> "); scanner.Scan(); fmt.Fprint(env.stdout, "> ") {
+        if err := s.handle(scanner.Text()); err == errQuit {
+            break
+        } else if err != nil {
+            fmt.Fprintln(env.stdout, "Error:", err)
+        }
+    }
+    fmt.Fprintln(env.stdout)
+    if s.unsaved {
+        fmt.Fprintln(env.stdout, "Learned prompts weren't saved")
+    }
+    return scanner.Err()
+}
+
+//handle runs line as a command, or replies to it
+func (s *session) handle(line string) error {
+    line = strings.TrimSpace(line)
+    if line == "" {
+        return nil
+    }
+    if strings.HasPrefix(line, ":") {
+        fields := strings.SplitN(line[1:], " ", 2)
+        cmd, ok := replCommands[fields[0]]
+        if !ok {
+            return fmt.Errorf("Unknown command %q, type :help for commands", line)
+        }
+        arg := ""
+        if len(fields) > 1 {
+            arg = strings.TrimSpace(fields[1])
+        }
+        return cmd.run(s, arg)
+    }
+
+    reply, err := s.brain.Generate(line)
+    if err != nil {
+        return err
+    }
+    fmt.Fprintln(s.out, reply)
+    return s.train(line)
+}
+
+//train trains the brain on prompt if learning is on
+func (s *session) train(prompt string) error {
+    if !s.learn {
+        return nil
+    }
+    if err := s.brain.Train(prompt); err != nil {
+        return err
+    }
+    s.unsaved = true
+    return nil
+}
+
+func (s *session) help(arg string) error {
+    names := make([]string, 0, len(replCommands))
+    for name := range replCommands {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        fmt.Fprintf(s.out, "  %-18s %s\n", replCommands[name].usage, replCommands[name].summary)
+    }
+    return nil
+}
+
+func (s *session) seed(arg string) error {
+    seed, err := strconv.ParseInt(arg, 10, 64)
+    if err != nil {
+        return fmt.Errorf("Expected a number to seed with, got %q", arg)
+    }
+    rand.Seed(seed)
+    return nil
+}
+
+func (s *session) explain(arg string) error {
+    reply, err := s.brain.Explain(arg)
+    if err != nil {
+        return err
+    }
+    if err := reply.Trace.WriteTable(s.out); err != nil {
+        return err
+    }
+    fmt.Fprintf(s.out, "Stopped: %s, probability: %.3g, took %v\n", reply.StopReason, reply.Probability(), reply.Duration)
+    fmt.Fprintln(s.out, reply.Text)
+    return s.train(arg)
+}
+
+func (s *session) stats(arg string) error {
+    top := markovchain.DefaultTop
+    if arg != "" {
+        var err error
+        if top, err = strconv.Atoi(arg); err != nil {
+            return fmt.Errorf("Expected a number of top tokens to list, got %q", arg)
+        }
+    }
+    return printStats(s.out, s.brain, false, top)
+}
+
+func (s *session) toggleLearn(arg string) error {
+    switch arg {
+    case "":
+        s.learn = !s.learn
+    case "on":
+        s.learn = true
+    case "off":
+        s.learn = false
+    default:
+        return fmt.Errorf("Expected on or off, got %q", arg)
+    }
+    if s.learn {
+        fmt.Fprintln(s.out, "Learning from prompts")
+    } else {
+        fmt.Fprintln(s.out, "Not learning from prompts")
+    }
+    return nil
+}
+
+func (s *session) save(arg string) error {
+    path := s.path
+    if arg != "" {
+        path = arg
+    }
+    if err := saveBrain(s.brain, path); err != nil {
+        return err
+    }
+    s.unsaved = false
+    fmt.Fprintln(s.out, "Saved to", path)
+    return nil
+}
+
+func (s *session) quit(arg string) error {
+    return errQuit
+}
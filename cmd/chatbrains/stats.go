@@ -0,0 +1,95 @@
+package main
+
+import (
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "sort"
+    doublemarkov "github.com/MattChubb/chatbrains/doublemarkov"
+    markov "github.com/MattChubb/chatbrains/markov"
+    "github.com/MattChubb/chatbrains/markovchain"
+)
+
+//stats describes what a brain has learned
+func stats(args []string, env env) error {
+    flags := flag.NewFlagSet("stats", flag.ContinueOnError)
+    flags.SetOutput(env.stderr)
+    flags.Usage = func() {
+        fmt.Fprintln(env.stderr, "Usage: chatbrains stats [flags]\n\nDescribes what a brain has learned.")
+        flags.PrintDefaults()
+    }
+    path, kind := brainFlags(flags)
+    asJSON := flags.Bool("json", false, "print stats as JSON")
+    top := flags.Int("top", markovchain.DefaultTop, "how many of the most frequent tokens and n-grams to list")
+    if err := parse(flags, args); err != nil {
+        return err
+    }
+
+    b, err := loadBrain(*path, *kind)
+    if err != nil {
+        return err
+    }
+    return printStats(env.stdout, b, *asJSON, *top)
+}
+
+func printStats(w io.Writer, b brain, asJSON bool, top int) error {
+    var stats interface{}
+    switch b := b.(type) {
+    case *markov.Brain:
+        stats = b.StatsTop(top)
+    case *doublemarkov.Brain:
+        stats = b.StatsTop(top)
+    default:
+        return fmt.Errorf("No stats for %T", b)
+    }
+
+    if asJSON {
+        data, err := json.MarshalIndent(stats, "", "  ")
+        if err != nil {
+            return err
+        }
+        _, err = fmt.Fprintf(w, "%s\n", data)
+        return err
+    }
+
+    switch stats := stats.(type) {
+    case markovchain.Stats:
+        writeChainStats(w, stats)
+    case doublemarkov.Stats:
+        fmt.Fprintln(w, "Forward chain:")
+        writeChainStats(w, stats.Forward)
+        fmt.Fprintln(w, "\nBackward chain:")
+        writeChainStats(w, stats.Backward)
+    }
+    return nil
+}
+
+func writeChainStats(w io.Writer, stats markovchain.Stats) {
+    fmt.Fprintf(w, "Order:          %d\n", stats.Order)
+    fmt.Fprintf(w, "Vocabulary:     %d\n", stats.Vocabulary)
+    fmt.Fprintf(w, "N-grams:        %d\n", stats.NGrams)
+    fmt.Fprintf(w, "Transitions:    %d\n", stats.Transitions)
+    fmt.Fprintf(w, "Total count:    %d\n", stats.TotalCount)
+    fmt.Fprintf(w, "Mean branching: %.2f\n", stats.MeanBranching)
+    fmt.Fprintf(w, "Memory:         ~%d KiB\n", stats.MemoryBytes/1024)
+
+    fmt.Fprintln(w, "Branching:")
+    branches := make([]int, 0, len(stats.Branching))
+    for branch := range stats.Branching {
+        branches = append(branches, branch)
+    }
+    sort.Ints(branches)
+    for _, branch := range branches {
+        fmt.Fprintf(w, "  %6d n-grams with %d next tokens\n", stats.Branching[branch], branch)
+    }
+
+    fmt.Fprintln(w, "Top tokens:")
+    for _, count := range stats.TopTokens {
+        fmt.Fprintf(w, "  %6d %q\n", count.Count, count.State)
+    }
+    fmt.Fprintln(w, "Top n-grams:")
+    for _, count := range stats.TopNGrams {
+        fmt.Fprintf(w, "  %6d %q\n", count.Count, count.State)
+    }
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    chatbrains "github.com/MattChubb/chatbrains"
+)
+
+//train trains a brain on each file given, or stdin if there are none,
+//creating the brain if its file doesn't exist yet
+func train(args []string, env env) error {
+    flags := flag.NewFlagSet("train", flag.ContinueOnError)
+    flags.SetOutput(env.stderr)
+    flags.Usage = func() {
+        fmt.Fprintln(env.stderr, "Usage: chatbrains train [flags] [file...]\n\nTrains a brain on each file, or stdin if there are none or the file is -.")
+        flags.PrintDefaults()
+    }
+    path, kind := brainFlags(flags)
+    order := flags.Int("order", 1, "order of a new brain's chains")
+    length := flags.Int("length", 30, "length limit in tokens of a new brain's replies")
+    formatName := flags.String("format", "text", "corpus format: text, jsonl or csv")
+    if err := parse(flags, args); err != nil {
+        return err
+    }
+    format, err := chatbrains.ParseFormat(*formatName)
+    if err != nil {
+        return err
+    }
+
+    b, err := loadBrain(*path, *kind)
+    if os.IsNotExist(err) {
+        b, err = newBrain(*kind)
+        if err != nil {
+            return err
+        }
+        b.Init(*order, *length)
+    } else if err != nil {
+        return err
+    }
+
+    files := flags.Args()
+    if len(files) == 0 {
+        files = []string{"-"}
+    }
+    var total chatbrains.TrainStats
+    for _, file := range files {
+        stats, err := trainFile(b, file, format, env.stdin)
+        total.Messages += stats.Messages
+        total.Tokens += stats.Tokens
+        total.Skipped += stats.Skipped
+        if err != nil {
+            return fmt.Errorf("Unable to train on %s: %v", file, err)
+        }
+    }
+
+    if err := saveBrain(b, *path); err != nil {
+        return err
+    }
+    fmt.Fprintf(env.stdout, "Trained on %d messages (%d tokens), skipped %d\n", total.Messages, total.Tokens, total.Skipped)
+    return nil
+}
+
+func trainFile(b brain, file string, format chatbrains.Format, stdin io.Reader) (chatbrains.TrainStats, error) {
+    r := stdin
+    if file != "-" {
+        f, err := os.Open(file)
+        if err != nil {
+            return chatbrains.TrainStats{}, err
+        }
+        defer f.Close()
+        r = f
+    }
+    return b.TrainFrom(r, format, nil)
+}
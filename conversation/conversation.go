@@ -0,0 +1,215 @@
+//Package conversation is a brain that learns which replies follow which
+//prompts, rather than treating every message in isolation
+package conversation
+
+import (
+    "bytes"
+	"encoding/json"
+    "fmt"
+	log "github.com/sirupsen/logrus"
+    "io"
+    "math/rand"
+    "regexp"
+    "sort"
+    "strings"
+    chatbrains "github.com/MattChubb/chatbrains"
+    markov "github.com/MattChubb/chatbrains/markov"
+)
+
+//DefaultBias is how often a reply starts with a word learned from similar
+//prompts, when there is one
+const DefaultBias = 0.75
+
+var wordPattern = regexp.MustCompile(`\w`)
+
+//Brain is a Markov brain trained on replies, which also remembers how the
+//replies to each prompt keyword began. When generating, it starts the reply
+//with a word that has followed similar prompts before.
+type Brain struct {
+    replies      *markov.Brain
+    associations map[string]map[string]int
+    bias         float64
+    previous     string
+}
+
+type brainJSON struct {
+    Replies      *markov.Brain
+    Associations map[string]map[string]int
+    Bias         float64
+}
+
+func (brain Brain) MarshalJSON() ([]byte, error) {
+    obj := brainJSON{
+        brain.replies,
+        brain.associations,
+        brain.bias,
+    }
+
+    return json.Marshal(obj)
+}
+
+func (brain *Brain) UnmarshalJSON(b []byte) error {
+    return brain.DecodeJSON(json.NewDecoder(bytes.NewReader(b)))
+}
+
+//DecodeJSON reads a brain saved with MarshalJSON from the next value in
+//decoder, streaming the chain rather than holding the raw JSON in memory
+func (brain *Brain) DecodeJSON(decoder *json.Decoder) error {
+    var obj brainJSON
+    err := chatbrains.DecodeObject(decoder, func(key string) error {
+        switch key {
+        case "Replies":
+            obj.Replies = new(markov.Brain)
+            return obj.Replies.DecodeJSON(decoder)
+        case "Associations":
+            return decoder.Decode(&obj.Associations)
+        case "Bias":
+            return decoder.Decode(&obj.Bias)
+        default:
+            return chatbrains.SkipValue(decoder)
+        }
+    })
+    if err != nil {
+        return err
+    }
+    if obj.Replies == nil {
+        return fmt.Errorf("Saved brain has no replies")
+    }
+
+    brain.replies = obj.Replies
+    brain.associations = obj.Associations
+    if brain.associations == nil {
+        brain.associations = make(map[string]map[string]int)
+    }
+    brain.bias = obj.Bias
+    brain.previous = ""
+    log.Debug("Braindump: ", brain)
+
+    return nil
+}
+
+//Load reads a brain saved with MarshalJSON from r
+func (brain *Brain) Load(r io.Reader) error {
+    return brain.DecodeJSON(json.NewDecoder(r))
+}
+
+func (brain *Brain) Init(order int, lengthLimit int) {
+    brain.replies = new(markov.Brain)
+    brain.replies.Init(order, lengthLimit)
+    brain.associations = make(map[string]map[string]int)
+    brain.bias = DefaultBias
+    brain.previous = ""
+    log.Debug("Braindump: ", brain)
+}
+
+//SetBias sets how often a reply starts with a word learned from similar
+//prompts, between 0 (never, like a plain Markov brain) and 1 (whenever
+//there is one)
+func (brain *Brain) SetBias(bias float64) error {
+    if bias < 0 || bias > 1 {
+        return fmt.Errorf("Bias must be between 0 and 1, got %v", bias)
+    }
+    brain.bias = bias
+    return nil
+}
+
+//Train trains the brain on a message, treating it as a reply to the message
+//trained before it. Messages should be given in the order they were sent.
+func (brain *Brain) Train(data string) error {
+    prompt := brain.previous
+    brain.previous = data
+    return brain.TrainPair(prompt, data)
+}
+
+//TrainPair trains the brain on reply, and remembers how it began so that
+//replies to prompts like this one can begin the same way. An empty prompt
+//trains the reply alone.
+func (brain *Brain) TrainPair(prompt string, reply string) error {
+    if err := brain.replies.Train(reply); err != nil {
+        return err
+    }
+
+    tokens, ok := opening(chatbrains.ProcessString(reply))
+    if !ok {
+        return nil
+    }
+    start := strings.Join(tokens, "")
+    for _, keyword := range chatbrains.Keywords(chatbrains.ProcessString(prompt)) {
+        if brain.associations[keyword] == nil {
+            brain.associations[keyword] = make(map[string]int)
+        }
+        brain.associations[keyword][start]++
+    }
+    log.Debug("Associated ", prompt, " with ", start)
+    return nil
+}
+
+//opening returns the tokens a processed message opens with, up to and
+//including its first word
+func opening(message []string) ([]string, bool) {
+    for i, token := range message {
+        if wordPattern.MatchString(token) {
+            return message[:i+1], true
+        }
+    }
+    return nil, false
+}
+
+//seed turns the opening of a reply back into the tokens to start a new reply
+//with. The chain was trained on the opening after start tokens, so it can
+//carry on from all of it, unless it's longer than the chain's order, when
+//it carries on from the word.
+func (brain *Brain) seed(start string) []string {
+    tokens := chatbrains.ProcessString(start)
+    if order := brain.replies.Order(); len(tokens) > order {
+        tokens = tokens[len(tokens)-order:]
+    }
+    return tokens
+}
+
+func (brain *Brain) Generate(prompt string) (string, error) {
+    log.Debug("Input: ", prompt)
+    processedPrompt := chatbrains.ProcessString(prompt)
+    log.Debug("Processed into: ", processedPrompt)
+
+    if rand.Float64() < brain.bias {
+        if start, ok := brain.start(chatbrains.Keywords(processedPrompt)); ok {
+            log.Debug("Starting reply with: ", start)
+            return brain.replies.GenerateFromSubject(brain.seed(start))
+        }
+    }
+    return brain.replies.Generate(prompt)
+}
+
+//start picks a word to begin a reply to a prompt with these keywords, in
+//proportion to how often replies to each keyword began with it
+func (brain *Brain) start(keywords []string) (string, bool) {
+    counts := make(map[string]int)
+    total := 0
+    for _, keyword := range keywords {
+        for start, count := range brain.associations[keyword] {
+            counts[start] += count
+            total += count
+        }
+    }
+    if total == 0 {
+        return "", false
+    }
+
+    //Go through starts in a fixed order, so the same random numbers always
+    //give the same reply
+    starts := make([]string, 0, len(counts))
+    for start := range counts {
+        starts = append(starts, start)
+    }
+    sort.Strings(starts)
+
+    r := rand.Intn(total)
+    for _, start := range starts {
+        r -= counts[start]
+        if r < 0 {
+            return start, true
+        }
+    }
+    return "", false
+}
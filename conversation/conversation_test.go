@@ -0,0 +1,140 @@
+package conversation
+
+import (
+    "encoding/json"
+    "reflect"
+    "regexp"
+    "testing"
+)
+
+func newBrain(order int, length int) *Brain {
+    brain := new(Brain)
+    brain.Init(order, length)
+    brain.TrainPair("how is the weather", "sunny today")
+    brain.TrainPair("what about the weather tomorrow", "rainy tomorrow")
+    brain.TrainPair("what's for dinner", "pizza tonight")
+    return brain
+}
+
+func TestTrain(t *testing.T) {
+    tables := []struct {
+        testcase string
+        reply    string
+        expected map[string]map[string]int
+    }{
+        {"Reply", "sunny today", map[string]map[string]int{"weather": {"sunny": 1}}},
+        {"Leading punctuation", "... sunny today", map[string]map[string]int{"weather": {"... sunny": 1}}},
+        {"No words", "!!!", map[string]map[string]int{}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(1, 32)
+        brain.Train("how is the weather")
+        brain.Train(table.reply)
+
+        //The first message wasn't a reply to anything
+        if !reflect.DeepEqual(brain.associations, table.expected) {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, brain.associations)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestGenerate(t *testing.T) {
+    tables := []struct {
+        testcase string
+        input    string
+        order    int
+        expected string
+    }{
+        {"Weather, order 1", "nice weather", 1, `^((Sunny)|(Rainy)) ((today)|(tomorrow)|(tonight))$`},
+        {"Weather, order 2", "nice weather", 2, `^((Sunny today)|(Rainy tomorrow))$`},
+        {"Dinner", "dinner time?", 2, `^Pizza tonight$`},
+        {"Unknown word", "testing", 2, `^Testing$`},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := newBrain(table.order, 32)
+        brain.SetBias(1)
+
+        got, err := brain.Generate(table.input)
+        t.Logf("Got: %s", got)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if match, _ := regexp.Match(table.expected, []byte(got)); !match {
+            t.Errorf("FAIL, expected: %s, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestGenerateOpening(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+        expected string
+    }{
+        {"Order 2", 2, `... cloudy later on`},
+        {"Order 3", 3, `... cloudy later on`},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(table.order, 32)
+        brain.SetBias(1)
+        //The reply opens with punctuation, so it has to be carried on from
+        //all of its opening rather than just the word
+        brain.TrainPair("is it warm out", "... cloudy later on")
+
+        got, err := brain.Generate("warm")
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if got != table.expected {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestSetBias(t *testing.T) {
+    brain := newBrain(1, 32)
+    for _, bias := range []float64{-0.1, 1.1} {
+        if err := brain.SetBias(bias); err == nil {
+            t.Errorf("FAIL, expected an error for bias %v", bias)
+        }
+    }
+    if err := brain.SetBias(0); err != nil || brain.bias != 0 {
+        t.Errorf("FAIL, unable to set bias: %v", err)
+    }
+}
+
+func TestMarshalJSON(t *testing.T) {
+    brain := newBrain(2, 32)
+    brain.SetBias(0.5)
+
+    b, err := json.Marshal(brain)
+    if err != nil {
+        t.Fatalf("FAIL, unable to marshal brain: %v", err)
+    }
+    got := new(Brain)
+    if err := json.Unmarshal(b, got); err != nil {
+        t.Fatalf("FAIL, unable to unmarshal brain: %v", err)
+    }
+
+    if !reflect.DeepEqual(got.associations, brain.associations) || got.bias != brain.bias {
+        t.Errorf("FAIL, expected: %#v, got: %#v", brain, got)
+    } else if reply, _ := got.Generate("weather"); reply == "" {
+        t.Errorf("FAIL, unable to generate from loaded brain")
+    }
+
+    if err := json.Unmarshal([]byte(`{"Bias":1}`), got); err == nil {
+        t.Errorf("FAIL, expected an error loading a brain without replies")
+    }
+}
@@ -0,0 +1,249 @@
+package brain
+
+import (
+    "bufio"
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+    log "github.com/sirupsen/logrus"
+)
+
+//Format is the layout of a corpus of training messages
+type Format int
+
+const (
+    //FormatText is one message per line
+    FormatText Format = iota
+    //FormatJSONL is one JSON object per line, with a "text" field and
+    //optional "author", "chat" and "time" fields
+    FormatJSONL
+    //FormatCSV is CSV with a header row naming a "text" column, and
+    //optionally "author", "chat" and "time" columns
+    FormatCSV
+)
+
+//ProgressInterval is how many messages are read between progress reports
+const ProgressInterval = 1000
+
+//Message is a single message read from a corpus
+type Message struct {
+    Text string
+    Meta
+}
+
+//TrainStats counts what was added to a brain from a corpus
+type TrainStats struct {
+    Messages int
+    Tokens   int
+    Skipped  int
+}
+
+func ParseFormat(name string) (Format, error) {
+    switch strings.ToLower(name) {
+    case "text", "txt":
+        return FormatText, nil
+    case "jsonl":
+        return FormatJSONL, nil
+    case "csv":
+        return FormatCSV, nil
+    default:
+        return 0, fmt.Errorf("Unknown corpus format %q", name)
+    }
+}
+
+//ReadCorpus calls fn with every message in r. Records that can't be parsed
+//are passed on as messages with no text, so they can be counted as skipped.
+func ReadCorpus(r io.Reader, format Format, fn func(Message) error) error {
+    switch format {
+    case FormatText:
+        return readText(r, fn)
+    case FormatJSONL:
+        return readJSONL(r, fn)
+    case FormatCSV:
+        return readCSV(r, fn)
+    default:
+        return fmt.Errorf("Unknown corpus format %d", format)
+    }
+}
+
+//TrainCorpus reads every message in r and passes it to train, which should
+//return how many tokens it added. Messages with no text are skipped.
+//progress, if not nil, is called every ProgressInterval messages.
+func TrainCorpus(r io.Reader, format Format, progress func(TrainStats), train func(string, *Meta) (int, error)) (TrainStats, error) {
+    read := func(fn func(Message) error) error {
+        return ReadCorpus(r, format, fn)
+    }
+    return TrainMessages(read, progress, train)
+}
+
+//TrainMessages is TrainCorpus for any source of messages. read should call
+//its argument with every message it finds.
+func TrainMessages(read func(func(Message) error) error, progress func(TrainStats), train func(string, *Meta) (int, error)) (TrainStats, error) {
+    var stats TrainStats
+    err := read(func(message Message) error {
+        if strings.TrimSpace(message.Text) == "" {
+            stats.Skipped++
+        } else {
+            var meta *Meta
+            if message.Meta != (Meta{}) {
+                meta = &message.Meta
+            }
+            tokens, err := train(message.Text, meta)
+            if err != nil {
+                return err
+            }
+            stats.Messages++
+            stats.Tokens += tokens
+        }
+
+        if progress != nil && (stats.Messages+stats.Skipped)%ProgressInterval == 0 {
+            progress(stats)
+        }
+        return nil
+    })
+
+    log.Info("Trained on ", stats.Messages, " messages, skipped ", stats.Skipped)
+    return stats, err
+}
+
+//TrainParallel is TrainMessages spread over several worker goroutines. train
+//is called concurrently, but never concurrently for the same worker, so each
+//worker can build its own partial brain to be merged once TrainParallel
+//returns. train should return how many tokens it added.
+func TrainParallel(read func(func(Message) error) error, workers int, progress func(TrainStats), train func(worker int, data string, meta *Meta) int) (TrainStats, error) {
+    if workers < 1 {
+        workers = 1
+    }
+
+    type job struct {
+        data string
+        meta *Meta
+    }
+    jobs := make(chan job, workers*16)
+    var tokens int64
+    var wg sync.WaitGroup
+    for i := 0; i < workers; i++ {
+        wg.Add(1)
+        go func(worker int) {
+            defer wg.Done()
+            for job := range jobs {
+                atomic.AddInt64(&tokens, int64(train(worker, job.data, job.meta)))
+            }
+        }(i)
+    }
+
+    //Tokens are counted by the workers, so progress reports lag a little
+    //behind the messages read
+    var report func(TrainStats)
+    if progress != nil {
+        report = func(stats TrainStats) {
+            stats.Tokens = int(atomic.LoadInt64(&tokens))
+            progress(stats)
+        }
+    }
+    stats, err := TrainMessages(read, report, func(data string, meta *Meta) (int, error) {
+        jobs <- job{data, meta}
+        return 0, nil
+    })
+
+    close(jobs)
+    wg.Wait()
+    stats.Tokens = int(tokens)
+    return stats, err
+}
+
+func readText(r io.Reader, fn func(Message) error) error {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for scanner.Scan() {
+        if err := fn(Message{Text: scanner.Text()}); err != nil {
+            return err
+        }
+    }
+    return scanner.Err()
+}
+
+type messageJSON struct {
+    Text   string    `json:"text"`
+    Author string    `json:"author"`
+    Chat   string    `json:"chat"`
+    Time   time.Time `json:"time"`
+}
+
+func readJSONL(r io.Reader, fn func(Message) error) error {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    line := 0
+    for scanner.Scan() {
+        line++
+        var obj messageJSON
+        if err := json.Unmarshal(scanner.Bytes(), &obj); err != nil {
+            log.Warn("Skipping line ", line, ": ", err)
+            obj = messageJSON{}
+        }
+
+        message := Message{obj.Text, Meta{obj.Author, obj.Chat, obj.Time}}
+        if err := fn(message); err != nil {
+            return err
+        }
+    }
+    return scanner.Err()
+}
+
+func readCSV(r io.Reader, fn func(Message) error) error {
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    reader.LazyQuotes = true
+
+    header, err := reader.Read()
+    if err != nil {
+        return err
+    }
+    columns := map[string]int{"text": -1, "author": -1, "chat": -1, "time": -1}
+    for i, name := range header {
+        if _, ok := columns[strings.ToLower(strings.TrimSpace(name))]; ok {
+            columns[strings.ToLower(strings.TrimSpace(name))] = i
+        }
+    }
+    if columns["text"] < 0 {
+        return fmt.Errorf("CSV header has no text column: %q", header)
+    }
+
+    field := func(record []string, name string) string {
+        if i := columns[name]; i >= 0 && i < len(record) {
+            return record[i]
+        }
+        return ""
+    }
+
+    for {
+        record, err := reader.Read()
+        if err == io.EOF {
+            return nil
+        } else if _, ok := err.(*csv.ParseError); ok {
+            log.Warn("Skipping record: ", err)
+            record = []string{}
+        } else if err != nil {
+            return err
+        }
+
+        message := Message{Text: field(record, "text")}
+        message.AuthorID = field(record, "author")
+        message.ChatID = field(record, "chat")
+        if t := field(record, "time"); t != "" {
+            if message.Time, err = time.Parse(time.RFC3339, t); err != nil {
+                log.Warn("Skipping record: ", err)
+                message = Message{}
+            }
+        }
+
+        if err := fn(message); err != nil {
+            return err
+        }
+    }
+}
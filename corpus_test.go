@@ -0,0 +1,132 @@
+package brain
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestReadCorpus(t *testing.T) {
+    when := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+    tables := []struct {
+        testcase string
+        format   Format
+        input    string
+        expected []Message
+        errors   bool
+    }{
+        {"Text", FormatText, "test data\n\ndata test\n", []Message{{Text: "test data"}, {Text: ""}, {Text: "data test"}}, false},
+        {"Text, no trailing newline", FormatText, "test data", []Message{{Text: "test data"}}, false},
+        {"JSONL", FormatJSONL, `{"text":"test data","author":"alice","chat":"chat","time":"2021-01-01T12:00:00Z"}` + "\n" + `{"text":"data"}`, []Message{{"test data", Meta{"alice", "chat", when}}, {Text: "data"}}, false},
+        {"JSONL, malformed line", FormatJSONL, `{"text":"test"}` + "\n" + `{"text":` + "\n" + `{"text":"data"}`, []Message{{Text: "test"}, {}, {Text: "data"}}, false},
+        {"CSV", FormatCSV, "author,text\nalice,test data\nbob,\"data, test\"\n", []Message{{"test data", Meta{AuthorID: "alice"}}, {"data, test", Meta{AuthorID: "bob"}}}, false},
+        {"CSV, all columns", FormatCSV, "Time,Chat,Author,Text\n2021-01-01T12:00:00Z,chat,alice,test\n", []Message{{"test", Meta{"alice", "chat", when}}}, false},
+        {"CSV, short record", FormatCSV, "text,author\ntest\n", []Message{{Text: "test"}}, false},
+        {"CSV, bad time", FormatCSV, "text,time\ntest,yesterday\n", []Message{{}}, false},
+        {"CSV, no text column", FormatCSV, "author,message\nalice,test\n", []Message{}, true},
+        {"Unknown format", Format(99), "test", []Message{}, true},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        got := []Message{}
+        err := ReadCorpus(strings.NewReader(table.input), table.format, func(message Message) error {
+            got = append(got, message)
+            return nil
+        })
+
+        if (err != nil) != table.errors {
+            t.Errorf("FAIL, expected errors: %v, got: %v", table.errors, err)
+        } else if !reflect.DeepEqual(got, table.expected) {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestTrainCorpus(t *testing.T) {
+    input := strings.Repeat("test data\n\n", ProgressInterval)
+
+    trained := []*Meta{}
+    reports := []TrainStats{}
+    stats, err := TrainCorpus(strings.NewReader(input), FormatText, func(stats TrainStats) {
+        reports = append(reports, stats)
+    }, func(data string, meta *Meta) (int, error) {
+        trained = append(trained, meta)
+        return len(ProcessString(data)), nil
+    })
+
+    expected := TrainStats{ProgressInterval, 3 * ProgressInterval, ProgressInterval}
+    if err != nil {
+        t.Errorf("FAIL, unexpected error: %v", err)
+    } else if stats != expected {
+        t.Errorf("FAIL, expected: %#v, got: %#v", expected, stats)
+    } else if len(trained) != ProgressInterval || trained[0] != nil {
+        t.Errorf("FAIL, expected %d messages without metadata, got: %#v", ProgressInterval, trained)
+    } else if len(reports) != 2 || reports[1] != expected {
+        t.Errorf("FAIL, expected 2 progress reports, got: %#v", reports)
+    } else {
+        t.Log("Passed")
+    }
+}
+
+func TestParseFormat(t *testing.T) {
+    tables := []struct {
+        testcase string
+        input    string
+        expected Format
+        errors   bool
+    }{
+        {"Text", "text", FormatText, false},
+        {"JSONL", "JSONL", FormatJSONL, false},
+        {"CSV", "csv", FormatCSV, false},
+        {"Unknown", "xml", 0, true},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        got, err := ParseFormat(table.input)
+        if (err != nil) != table.errors || got != table.expected {
+            t.Errorf("FAIL, expected: %#v, got: %#v (%v)", table.expected, got, err)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestTrainParallel(t *testing.T) {
+    input := strings.Repeat("test data\n\n", ProgressInterval)
+    read := func(fn func(Message) error) error {
+        return ReadCorpus(strings.NewReader(input), FormatText, fn)
+    }
+
+    workers := 4
+    trained := make([]int, workers)
+    reports := 0
+    stats, err := TrainParallel(read, workers, func(stats TrainStats) {
+        reports++
+    }, func(worker int, data string, meta *Meta) int {
+        //Each worker has its own slot, so there's no need to lock
+        trained[worker]++
+        return len(ProcessString(data))
+    })
+
+    total := 0
+    for _, n := range trained {
+        total += n
+    }
+    expected := TrainStats{ProgressInterval, 3 * ProgressInterval, ProgressInterval}
+    if err != nil {
+        t.Errorf("FAIL, unexpected error: %v", err)
+    } else if stats != expected {
+        t.Errorf("FAIL, expected: %#v, got: %#v", expected, stats)
+    } else if total != ProgressInterval {
+        t.Errorf("FAIL, expected %d messages trained, got: %d", ProgressInterval, total)
+    } else if reports != 2 {
+        t.Errorf("FAIL, expected 2 progress reports, got: %d", reports)
+    } else {
+        t.Log("Passed")
+    }
+}
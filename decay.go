@@ -0,0 +1,38 @@
+package brain
+
+import (
+    "math"
+    "time"
+)
+
+//DecayResolution is the weight each message is trained with once decay is
+//enabled, so that counts can be scaled down without rounding them away
+const DecayResolution = 1000
+
+//decaySteps is how many times per half-life counts are scaled down
+const decaySteps = 16
+
+//Decay tracks how far a brain's transition counts have decayed, so that
+//older training data gradually becomes less likely than newer data
+type Decay struct {
+    HalfLife time.Duration
+    Last     time.Time
+}
+
+//DecayStep is a single scaling of a brain's counts
+type DecayStep struct {
+    Factor float64
+    Time   time.Time
+}
+
+//Step works out how much counts should be scaled by to bring them up to now.
+//It returns false if too little time has passed to be worth doing yet.
+func (decay Decay) Step(now time.Time) (DecayStep, bool) {
+    elapsed := now.Sub(decay.Last)
+    if decay.HalfLife <= 0 || elapsed < decay.HalfLife/decaySteps {
+        return DecayStep{}, false
+    }
+
+    factor := math.Pow(0.5, float64(elapsed)/float64(decay.HalfLife))
+    return DecayStep{factor, now}, true
+}
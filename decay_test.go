@@ -0,0 +1,41 @@
+package brain
+
+import (
+    "math"
+    "testing"
+    "time"
+)
+
+func TestDecayStep(t *testing.T) {
+    last := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+    tables := []struct {
+        testcase string
+        halfLife time.Duration
+        elapsed  time.Duration
+        due      bool
+        factor   float64
+    }{
+        {"Disabled", 0, time.Hour, false, 0},
+        {"No time passed", time.Hour, 0, false, 0},
+        {"Too soon", time.Hour, time.Minute, false, 0},
+        {"One half-life", time.Hour, time.Hour, true, 0.5},
+        {"Two half-lives", time.Hour, 2 * time.Hour, true, 0.25},
+        {"Half a half-life", time.Hour, 30 * time.Minute, true, math.Sqrt(0.5)},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        decay := Decay{table.halfLife, last}
+        step, due := decay.Step(last.Add(table.elapsed))
+
+        if due != table.due {
+            t.Errorf("FAIL, expected due: %v, got: %v", table.due, due)
+        } else if due && math.Abs(step.Factor-table.factor) > 1e-9 {
+            t.Errorf("FAIL, expected factor: %v, got: %v", table.factor, step.Factor)
+        } else if due && !step.Time.Equal(last.Add(table.elapsed)) {
+            t.Errorf("FAIL, expected time: %v, got: %v", last.Add(table.elapsed), step.Time)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
@@ -0,0 +1,44 @@
+package brain
+
+import (
+    "encoding/json"
+    "fmt"
+)
+
+//JSONDecoder is implemented by brains that can be read straight from a JSON
+//stream, without holding the raw JSON in memory alongside the decoded brain
+type JSONDecoder interface {
+    DecodeJSON(decoder *json.Decoder) error
+}
+
+//DecodeObject reads a JSON object from decoder one field at a time, calling
+//decodeValue with each key. decodeValue must consume the field's value.
+func DecodeObject(decoder *json.Decoder, decodeValue func(key string) error) error {
+    token, err := decoder.Token()
+    if err != nil {
+        return err
+    }
+    if delim, ok := token.(json.Delim); !ok || delim != '{' {
+        return fmt.Errorf("Expected JSON object, got %v", token)
+    }
+
+    for decoder.More() {
+        token, err := decoder.Token()
+        if err != nil {
+            return err
+        }
+        if err := decodeValue(token.(string)); err != nil {
+            return err
+        }
+    }
+
+    //Consume the closing brace
+    _, err = decoder.Token()
+    return err
+}
+
+//SkipValue discards the next value in decoder
+func SkipValue(decoder *json.Decoder) error {
+    var skip json.RawMessage
+    return decoder.Decode(&skip)
+}
@@ -1,27 +1,33 @@
 package doublemarkov
 
 import (
+    "bytes"
 	"encoding/json"
-	"github.com/mb-14/gomarkov"
+    "fmt"
 	log "github.com/sirupsen/logrus"
+    "io"
     "math"
     "regexp"
-	"strings"
     chatbrains "github.com/MattChubb/chatbrains"
     markov "github.com/MattChubb/chatbrains/markov"
+    "github.com/MattChubb/chatbrains/markovchain"
 )
 
-//TODO Use a bi-directional markov chain instead of 2 separate chains to lower memory footprint
+//Brain generates the words before a reply's subject backwards, and the
+//words after it forwards. Probabilities of the words before the subject are
+//of them coming before the next word, and traces label each step with the
+//chain that took it, backward or forward.
 type Brain struct {
-    bckChain    *gomarkov.Chain
-    fwdChain    *gomarkov.Chain
-    lengthLimit int
+    markov.Base
+    //TODO Use a bi-directional markov chain instead of 2 separate chains to lower memory footprint
+    bckChain *markovchain.Chain
+    fwdChain *markovchain.Chain
 }
 
 type brainJSON struct {
-    BckChain    *gomarkov.Chain
-    FwdChain    *gomarkov.Chain
-    LengthLimit int
+    BckChain *markovchain.Chain
+    FwdChain *markovchain.Chain
+    markov.Settings
 }
 
 func (brain Brain) MarshalJSON() ([]byte, error) {
@@ -30,90 +36,191 @@ func (brain Brain) MarshalJSON() ([]byte, error) {
     obj := brainJSON{
         brain.bckChain,
         brain.fwdChain,
-        brain.lengthLimit,
+        brain.Settings(),
     }
 
     return json.Marshal(obj)
 }
 
 func (brain *Brain) UnmarshalJSON(b []byte) error {
-	var obj brainJSON
-	err := json.Unmarshal(b, &obj)
-	if err != nil {
-		return err
-	}
+    return brain.DecodeJSON(json.NewDecoder(bytes.NewReader(b)))
+}
+
+//DecodeJSON reads a brain saved with MarshalJSON from the next value in
+//decoder, streaming the chains rather than holding the raw JSON in memory
+func (brain *Brain) DecodeJSON(decoder *json.Decoder) error {
+    var obj brainJSON
+    err := chatbrains.DecodeObject(decoder, func(key string) error {
+        switch key {
+        case "BckChain":
+            obj.BckChain = new(markovchain.Chain)
+            return obj.BckChain.DecodeJSON(decoder)
+        case "FwdChain":
+            obj.FwdChain = new(markovchain.Chain)
+            return obj.FwdChain.DecodeJSON(decoder)
+        default:
+            return markov.DecodeSetting(decoder, key, &obj.Settings)
+        }
+    })
+    if err != nil {
+        return err
+    }
+    if obj.FwdChain == nil || obj.BckChain == nil {
+        return fmt.Errorf("Saved brain is missing its forward or backward chain")
+    }
 
     brain.bckChain = obj.BckChain
     brain.fwdChain = obj.FwdChain
-    brain.lengthLimit = obj.LengthLimit
+    brain.Base = markov.NewBase(brain, pair{brain.bckChain, brain.fwdChain}, obj.Settings)
     log.Debug("Braindump: ", brain)
 
     return nil
 }
 
+//Load reads a brain saved with MarshalJSON from r
+func (brain *Brain) Load(r io.Reader) error {
+    return brain.DecodeJSON(json.NewDecoder(r))
+}
+
 func (brain *Brain) Init(order int, lengthLimit int) {
-	brain.bckChain = gomarkov.NewChain(order)
-	brain.fwdChain = gomarkov.NewChain(order)
-    brain.lengthLimit = lengthLimit
+	brain.bckChain = markovchain.NewChain(order)
+	brain.fwdChain = markovchain.NewChain(order)
+    brain.Base = markov.NewBase(brain, pair{brain.bckChain, brain.fwdChain}, markov.Settings{LengthLimit: lengthLimit})
     log.Debug("Braindump: ", brain)
 }
 
-func (brain *Brain) Train(data string) error {
-    log.Debug("Braindump: ", brain)
-    log.Debug("Training data: ", data)
+//Merge adds everything other has been trained on to the brain. Both brains
+//must have the same order.
+func (brain *Brain) Merge(other *Brain) error {
+    return brain.MergeWeighted(other, 1, 1)
+}
 
-    processedData := chatbrains.ProcessString(data)
-    log.Debug("Processed into: ", processedData)
+//MergeWeighted is Merge, but with the brain's existing counts multiplied by
+//weight and other's by otherWeight, so one source can count for more than
+//the other
+func (brain *Brain) MergeWeighted(other *Brain, weight int, otherWeight int) error {
+    return brain.Base.MergeWeighted(&other.Base, weight, otherWeight)
+}
 
-    brain.fwdChain.Add(processedData)
-    reverse(processedData)
-    log.Debug("Reversed: ", processedData)
-    brain.bckChain.Add(processedData)
-    return nil
+//Stats describes what each of a brain's chains has learned
+type Stats struct {
+    Forward  markovchain.Stats
+    Backward markovchain.Stats
+}
+
+//Stats describes what the brain has learned, for monitoring, listing the
+//DefaultTop most frequent tokens and n-grams of each chain. With decay
+//enabled, counts are in units of DecayResolution per message.
+func (brain *Brain) Stats() Stats {
+    return brain.StatsTop(markovchain.DefaultTop)
+}
+
+//StatsTop is Stats, but listing the top most frequent tokens and n-grams
+func (brain *Brain) StatsTop(top int) Stats {
+    return Stats{
+        Forward:  brain.fwdChain.Stats(top),
+        Backward: brain.bckChain.Stats(top),
+    }
+}
+
+//pair is the Chains of a Brain: the backward chain is trained on every
+//message reversed
+type pair struct {
+    bck *markovchain.Chain
+    fwd *markovchain.Chain
+}
+
+func (chains pair) Order() int {
+    return chains.fwd.Order
+}
+
+func (chains pair) Forward() (*markovchain.Chain, string) {
+    return chains.fwd, "forward"
+}
+
+func (chains pair) Add(tokens []string, weight int) {
+    chains.fwd.AddWeighted(tokens, weight)
+    reversed := reversed(tokens)
+    log.Debug("Reversed: ", reversed)
+    chains.bck.AddWeighted(reversed, weight)
+}
+
+func (chains pair) Contains(tokens []string) bool {
+    return chains.fwd.Contains(tokens) && chains.bck.Contains(reversed(tokens))
+}
+
+//Remove takes tokens out of both chains, leaving neither changed if either
+//doesn't know about them
+func (chains pair) Remove(tokens []string, weight int) error {
+    if !chains.Contains(tokens) {
+        return fmt.Errorf("Brain doesn't contain %q", tokens)
+    }
+
+    if err := chains.fwd.Remove(tokens, weight); err != nil {
+        return err
+    }
+    return chains.bck.Remove(reversed(tokens), weight)
+}
+
+func (chains pair) Scale(factor float64) {
+    chains.fwd.Scale(factor)
+    chains.bck.Scale(factor)
 }
 
-func (brain *Brain) Generate(prompt string) (string, error) {
-    processedPrompt := chatbrains.ProcessString(prompt)
-	subject := []string{}
-	if len(processedPrompt) > 0 {
-		subject = chatbrains.ExtractSubject(processedPrompt, brain.fwdChain.Order)
-	}
-	//TODO Any other clever Markov hacks?
-	sentence := brain.generateSentence(brain.bckChain, subject)
-	end := brain.generateSentence(brain.fwdChain, subject)
+func (chains pair) Prune(threshold int) {
+    chains.fwd.Prune(threshold)
+    chains.bck.Prune(threshold)
+}
 
-    if len(sentence) > brain.bckChain.Order {
+func (chains pair) Empty() markov.Chains {
+    return pair{markovchain.NewChain(chains.bck.Order), markovchain.NewChain(chains.fwd.Order)}
+}
+
+func (chains pair) Merge(other markov.Chains, weight int) error {
+    if err := chains.fwd.Merge(other.(pair).fwd, weight); err != nil {
+        return err
+    }
+    return chains.bck.Merge(other.(pair).bck, weight)
+}
+
+//Sentence generates both halves of a sentence around subject, each getting
+//half the length
+func (chains pair) Sentence(subject []string, lengthLimit int, limits chatbrains.Limits, trace *chatbrains.Trace) markov.Draft {
+    half := int(math.Round(float64(lengthLimit)/2))
+	sentence := markov.GenerateSentence(chains.bck, "backward", subject, half, limits.Half(), trace)
+	end := markov.GenerateSentence(chains.fwd, "forward", subject, half, limits.Half(), trace)
+
+    tokens := sentence.Tokens
+    probabilities := sentence.Probabilities
+    if len(tokens) > chains.bck.Order {
         // Don't start a sentence with punctuation
-        if match, _ := regexp.Match(`\W`, []byte(sentence[len(sentence)-1])); match {
-            sentence = sentence[brain.bckChain.Order:len(sentence)-1]
-        } else {
-            sentence = sentence[brain.bckChain.Order:]
+        last := len(tokens)
+        if match, _ := regexp.Match(`\W`, []byte(tokens[len(tokens)-1])); match {
+            last--
         }
+        tokens = tokens[chains.bck.Order:last]
+        probabilities = probabilities[chains.bck.Order:last]
     } else {
         //Sentence is just the subject, which is duplicated in the fwd chain
-        sentence = []string{}
+        tokens = []string{}
+        probabilities = []float64{}
     }
-    reverse(sentence)
-    sentence = append(sentence, end...)
-    sentence[0] = strings.Title(sentence[0])
+    reverse(tokens)
+    reverseFloats(probabilities)
 
-    return strings.Join(sentence, ""), nil
+    return markov.Draft{
+        Tokens:        append(tokens, end.Tokens...),
+        Probabilities: append(probabilities, end.Probabilities...),
+        Stop:          end.Stop,
+    }
 }
 
-func (brain *Brain) generateSentence(chain *gomarkov.Chain, init []string) []string {
-    log.Debug("Input: ", init)
-    order := chain.Order
-    tokens := markov.GenerateInitialToken(init, order)
-    log.Debug("Initial token: ", tokens)
-
-	for tokens[len(tokens)-1] != gomarkov.EndToken &&
-        len(tokens) < int(math.Round(float64(brain.lengthLimit)/2)) {
-        next := markov.GenerateNextToken(chain, tokens)
-        tokens = append(tokens, next)
-	}
-
-	//Don't include the start or end token in our response
-    return markov.TrimTokens(tokens)
+//reversed returns a reversed copy of tokens
+func reversed(tokens []string) []string {
+    reversed := make([]string, len(tokens))
+    copy(reversed, tokens)
+    reverse(reversed)
+    return reversed
 }
 
 func reverse(ss []string) {
@@ -122,3 +229,10 @@ func reverse(ss []string) {
         ss[i], ss[last-i] = ss[last-i], ss[i]
     }
 }
+
+func reverseFloats(fs []float64) {
+    last := len(fs) - 1
+    for i := 0; i < len(fs)/2; i++ {
+        fs[i], fs[last-i] = fs[last-i], fs[i]
+    }
+}
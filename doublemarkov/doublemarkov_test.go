@@ -1,11 +1,19 @@
 package doublemarkov
 
 import (
+    "bytes"
+    "fmt"
+    "math"
 	log "github.com/sirupsen/logrus"
 	"testing"
 	"reflect"
     "regexp"
-	"github.com/mb-14/gomarkov"
+    "github.com/MattChubb/chatbrains/markovchain"
+    "strings"
+    "time"
+    chatbrains "github.com/MattChubb/chatbrains"
+    "github.com/MattChubb/chatbrains/internal/benchdata"
+    markov "github.com/MattChubb/chatbrains/markov"
 )
 
 func TestMain(m *testing.M) {
@@ -170,15 +178,15 @@ func TestGenerateSentence(t *testing.T) {
 		t.Logf("Testing: %s", table.testcase)
         brain := newBrain(table.order, length)
 
-		got := brain.generateSentence(brain.fwdChain, table.input)
+		got := markov.GenerateSentence(brain.fwdChain, "forward", table.input, length/2, chatbrains.Limits{}, nil).Tokens
 
 		if len(got) < 1 {
 			t.Errorf("prompt: %#v, got: %#v", table.input, got)
 		} else if len(got) > length/2 {
 			t.Errorf("Response largr than lengthlimit, got: %#v", got)
-		} else if got[0] == gomarkov.StartToken {
+		} else if got[0] == markovchain.StartToken {
 			t.Errorf("Start token found, got: %#v", got)
-		} else if got[len(got)-1] == gomarkov.EndToken {
+		} else if got[len(got)-1] == markovchain.EndToken {
 			t.Errorf("End token found, got: %#v", got)
 		}
 
@@ -260,3 +268,586 @@ func TestUnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestLoad(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+    }{
+        {"Order 1", 1},
+        {"Order 2", 2},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        expected := newBrain(table.order, 31)
+        saved, _ := expected.MarshalJSON()
+
+        brain := new(Brain)
+        if err := brain.Load(bytes.NewReader(saved)); err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+            continue
+        }
+        got, _ := brain.MarshalJSON()
+        if string(got) != string(saved) {
+            t.Errorf("FAIL, expected: %s, got: %s", saved, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestLoadErrors(t *testing.T) {
+    tables := []struct {
+        testcase string
+        input    string
+    }{
+        {"Truncated JSON", `{"LengthLimit":31,`},
+        {"Empty object", `{}`},
+        {"No backward chain", `{"FwdChain":{"int":1,"spool_map":{},"freq_mat":{}},"LengthLimit":31}`},
+        {"A markov brain", `{"Chain":{"int":1,"spool_map":{},"freq_mat":{}},"LengthLimit":31}`},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        if err := brain.Load(strings.NewReader(table.input)); err == nil {
+            t.Errorf("FAIL, expected an error loading %s", table.input)
+        } else {
+            t.Logf("Passed (%v)", err)
+        }
+    }
+}
+
+func TestDecay(t *testing.T) {
+    brain := new(Brain)
+    brain.Init(1, 32)
+    brain.Train("old")
+    if err := brain.EnableDecay(time.Hour); err != nil {
+        t.Fatalf("FAIL, unable to enable decay: %v", err)
+    }
+    brain.Train("old")
+    brain.Train("old")
+
+    //Two half-lives later, old messages count for a quarter as much
+    brain.Decay(time.Now().Add(2 * time.Hour))
+    brain.Train("new")
+
+    oldP, _ := brain.fwdChain.TransitionProbability("old", markovchain.NGram{markovchain.StartToken})
+    newP, _ := brain.fwdChain.TransitionProbability("new", markovchain.NGram{markovchain.StartToken})
+    if math.Abs(oldP-0.75/1.75) > 1e-3 || math.Abs(newP-1/1.75) > 1e-3 {
+        t.Errorf("FAIL, expected old: %.3f, new: %.3f, got old: %.3f, new: %.3f", 0.75/1.75, 1/1.75, oldP, newP)
+    } else {
+        t.Log("Passed")
+    }
+}
+
+func TestPrune(t *testing.T) {
+    tables := []struct {
+        testcase  string
+        decay     bool
+        threshold int
+        expected  []string
+    }{
+        {"Nothing pruned", false, 1, []string{"common", "rare"}},
+        {"Rare word pruned", false, 2, []string{"common"}},
+        {"Everything pruned", false, 3, []string{}},
+        {"Rare word pruned, with decay", true, 2, []string{"common"}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(1, 32)
+        if table.decay {
+            brain.EnableDecay(time.Hour)
+        }
+        brain.Train("common")
+        brain.Train("common")
+        brain.Train("rare")
+
+        if err := brain.Prune(table.threshold); err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        }
+        got := []string{}
+        for _, word := range []string{"common", "rare"} {
+            if p, _ := brain.fwdChain.TransitionProbability(word, markovchain.NGram{markovchain.StartToken}); p > 0 {
+                got = append(got, word)
+            }
+        }
+        if !reflect.DeepEqual(got, table.expected) {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestUntrain(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+        input    string
+        decay    bool
+    }{
+        {"New words, order 1", 1, "my password is hunter2", false},
+        {"New words, order 2", 2, "my password is hunter2", false},
+        {"Known words", 1, "data test", false},
+        {"Repeated message", 2, "test data test data", false},
+        {"With decay", 2, "my password is hunter2", true},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := newBrain(table.order, 32)
+        if table.decay {
+            brain.EnableDecay(time.Hour)
+        }
+        expected, _ := brain.MarshalJSON()
+
+        brain.Train(table.input)
+        if err := brain.Untrain(table.input); err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        }
+
+        got, _ := brain.MarshalJSON()
+        if string(got) != string(expected) {
+            t.Errorf("FAIL, expected: %s, got: %s", expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+
+    brain := newBrain(1, 32)
+    expected, _ := brain.MarshalJSON()
+    if err := brain.Untrain("never seen this"); err == nil {
+        t.Errorf("FAIL, expected an error untraining an unknown message")
+    }
+    if got, _ := brain.MarshalJSON(); string(got) != string(expected) {
+        t.Errorf("FAIL, failed untrain changed brain to: %s", got)
+    }
+}
+
+func TestEraseAuthor(t *testing.T) {
+    when := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+    bob := chatbrains.Meta{AuthorID: "bob", ChatID: "chat", Time: when}
+    alice := chatbrains.Meta{AuthorID: "alice", ChatID: "chat", Time: when}
+
+    expected := new(Brain)
+    expected.Init(2, 32)
+    expected.TrainWithMeta("test data", bob)
+    expected.TrainWithMeta("data test data", bob)
+
+    brain := new(Brain)
+    brain.Init(2, 32)
+    brain.TrainWithMeta("test data", bob)
+    brain.TrainWithMeta("my secret data", alice)
+    brain.TrainWithMeta("data test data", bob)
+    brain.TrainWithMeta("test secret", alice)
+
+    //The index of who said what should survive a save and load
+    saved, _ := brain.MarshalJSON()
+    brain = new(Brain)
+    brain.UnmarshalJSON(saved)
+
+    if erased, err := brain.EraseAuthor("alice"); err != nil {
+        t.Errorf("FAIL, unexpected error: %v", err)
+    } else if erased != 2 {
+        t.Errorf("FAIL, expected 2 messages erased, got %d", erased)
+    }
+    if erased, _ := brain.EraseAuthor("alice"); erased != 0 {
+        t.Errorf("FAIL, expected nothing left to erase, got %d", erased)
+    }
+
+    if !brain.fwdChain.Equal(expected.fwdChain) || !brain.bckChain.Equal(expected.bckChain) {
+        t.Errorf("FAIL, expected: %#v, got: %#v", expected, brain)
+    } else {
+        t.Log("Passed")
+    }
+}
+
+func TestTrainParallel(t *testing.T) {
+    var input strings.Builder
+    for i := 0; i < 500; i++ {
+        fmt.Fprintf(&input, "{\"text\":\"test data %d test data\",\"author\":\"user%d\"}\n{}\n", i, i%3)
+    }
+
+    tables := []struct {
+        testcase string
+        workers  int
+    }{
+        {"One worker", 1},
+        {"Several workers", 4},
+        {"One worker per CPU", 0},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        expected := new(Brain)
+        expected.Init(2, 32)
+        expectedStats, _ := expected.TrainFrom(strings.NewReader(input.String()), chatbrains.FormatJSONL, nil)
+
+        brain := new(Brain)
+        brain.Init(2, 32)
+        got, err := brain.TrainParallel(strings.NewReader(input.String()), chatbrains.FormatJSONL, table.workers, nil)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if got != expectedStats {
+            t.Errorf("FAIL, expected: %#v, got: %#v", expectedStats, got)
+        } else if !brain.fwdChain.Equal(expected.fwdChain) || !brain.bckChain.Equal(expected.bckChain) {
+            t.Errorf("FAIL, brain not trained as expected")
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestMerge(t *testing.T) {
+    tables := []struct {
+        testcase    string
+        order       int
+        weight      int
+        otherWeight int
+        errors      bool
+    }{
+        {"Equal weights", 2, 1, 1, false},
+        {"Weighted", 2, 2, 3, false},
+        {"Different orders", 1, 1, 1, true},
+        {"Zero weight", 2, 0, 1, true},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(2, 32)
+        brain.Train("test data test data")
+        other := new(Brain)
+        other.Init(table.order, 32)
+        other.TrainWithMeta("data test data", chatbrains.Meta{AuthorID: "alice"})
+
+        expected := markovchain.NewChain(2)
+        expected.AddWeighted(chatbrains.ProcessString("test data test data"), table.weight)
+        expected.AddWeighted(chatbrains.ProcessString("data test data"), table.otherWeight)
+        expectedBck := markovchain.NewChain(2)
+        for data, weight := range map[string]int{"test data test data": table.weight, "data test data": table.otherWeight} {
+            reversed := chatbrains.ProcessString(data)
+            reverse(reversed)
+            expectedBck.AddWeighted(reversed, weight)
+        }
+
+        err := brain.MergeWeighted(other, table.weight, table.otherWeight)
+        if (err != nil) != table.errors {
+            t.Errorf("FAIL, expected errors: %v, got: %v", table.errors, err)
+        } else if table.errors {
+            t.Log("Passed")
+        } else if !brain.fwdChain.Equal(expected) || !brain.bckChain.Equal(expectedBck) {
+            t.Errorf("FAIL, brain not merged as expected, got: %#v", brain)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestMergeDecay(t *testing.T) {
+    brain := new(Brain)
+    brain.Init(2, 32)
+    brain.EnableDecay(time.Hour)
+    other := newBrain(2, 32)
+
+    if err := brain.Merge(other); err != nil {
+        t.Fatalf("FAIL, unexpected error: %v", err)
+    }
+    expected := newBrain(2, 32)
+    expected.fwdChain.Scale(chatbrains.DecayResolution)
+    expected.bckChain.Scale(chatbrains.DecayResolution)
+    if !brain.fwdChain.Equal(expected.fwdChain) || !brain.bckChain.Equal(expected.bckChain) {
+        t.Errorf("FAIL, expected counts scaled to decay resolution, got: %#v", brain)
+    }
+    if err := other.Merge(brain); err == nil {
+        t.Errorf("FAIL, expected an error merging a decaying brain into one without decay")
+    }
+}
+
+func TestGenerateFor(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+        expected string
+    }{
+        {"Order 1", 1, `(?i)\bnode\b`},
+        //The subject from memory should be padded to the order, or the
+        //reply couldn't carry on from it
+        {"Order 2", 2, `(?i)\bnode graph\b`},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := newBrain(table.order, 32)
+        brain.Train("a node graph")
+        memory := chatbrains.NewMemory(4, time.Hour)
+        brain.SetMemory(memory)
+
+        memory.Remember("chat", "the node")
+        got, err := brain.GenerateFor("chat", "and the")
+        t.Logf("Got: %s", got)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if match, _ := regexp.Match(table.expected, []byte(got)); !match {
+            t.Errorf("FAIL, expected a reply about node, got: %#v", got)
+        }
+
+        context := memory.Context("chat")
+        expected := append(append(chatbrains.ProcessString("the node"), chatbrains.ProcessString("and the")...), chatbrains.ProcessString(got)...)
+        if !reflect.DeepEqual(context, expected) {
+            t.Errorf("FAIL, expected the prompt and reply to be remembered, got: %#v", context)
+        }
+
+        //Other conversations shouldn't be affected
+        if len(memory.Context("other")) != 0 {
+            t.Errorf("FAIL, expected nothing remembered for another chat")
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestLimits(t *testing.T) {
+    tables := []struct {
+        testcase string
+        limits   chatbrains.Limits
+    }{
+        {"Words", chatbrains.Limits{MaxWords: 4}},
+        {"Characters", chatbrains.Limits{MaxChars: 20}},
+        {"Both", chatbrains.Limits{MaxWords: 6, MaxChars: 25}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(1, 8)
+        brain.Train("test data test data test data test data test data test data.")
+        brain.Train("data test, data test data test data test data test data test!")
+        brain.SetLimits(table.limits)
+        brain.SetMaxSentences(3)
+
+        //Should survive a save and load
+        b, _ := brain.MarshalJSON()
+        brain = new(Brain)
+        brain.UnmarshalJSON(b)
+
+        for i := 0; i < 50; i++ {
+            got, err := brain.Generate("test")
+            words := chatbrains.CountWords(chatbrains.ProcessString(got))
+            if err != nil {
+                t.Errorf("FAIL, unexpected error: %v", err)
+            } else if (table.limits.MaxWords > 0 && words > table.limits.MaxWords) || (table.limits.MaxChars > 0 && len(got) > table.limits.MaxChars) {
+                t.Errorf("FAIL, expected a reply within %#v, got: %#v", table.limits, got)
+            } else if strings.HasSuffix(got, " ") || strings.HasSuffix(got, ",") {
+                t.Errorf("FAIL, expected a reply ending at a natural boundary, got: %#v", got)
+            }
+        }
+    }
+}
+
+func TestMinLength(t *testing.T) {
+    tables := []struct {
+        testcase string
+        limits   chatbrains.Limits
+    }{
+        {"Resample", chatbrains.Limits{MinWords: 5, Strategy: chatbrains.Resample, Retries: 50}},
+        {"Suppress end", chatbrains.Limits{MinWords: 5, Strategy: chatbrains.SuppressEnd, Retries: 50}},
+        {"With a maximum", chatbrains.Limits{MinWords: 5, MaxWords: 12, Strategy: chatbrains.SuppressEnd, Retries: 50}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(1, 30)
+        brain.Train("test")
+        brain.Train("test data test data test data test data")
+        brain.SetLimits(table.limits)
+
+        //Should survive a save and load
+        b, _ := brain.MarshalJSON()
+        brain = new(Brain)
+        brain.UnmarshalJSON(b)
+
+        for i := 0; i < 50; i++ {
+            got, err := brain.Generate("test")
+            words := chatbrains.CountWords(chatbrains.ProcessString(got))
+            if err != nil {
+                t.Errorf("FAIL, unexpected error: %v", err)
+            } else if words < table.limits.MinWords {
+                t.Errorf("FAIL, expected at least %v words, got: %#v", table.limits.MinWords, got)
+            } else if table.limits.MaxWords > 0 && words > table.limits.MaxWords {
+                t.Errorf("FAIL, expected at most %v words, got: %#v", table.limits.MaxWords, got)
+            }
+        }
+    }
+}
+
+func TestGenerateDetailed(t *testing.T) {
+    tables := []struct {
+        testcase    string
+        lengthLimit int
+        message     string
+        prompt      string
+        expected    chatbrains.StopReason
+    }{
+        {"End", 30, "test data", "test", chatbrains.StopEnd},
+        {"Length", 6, "test,alpha;bravo:charlie-delta/echo", "test", chatbrains.StopLength},
+        {"Unknown", 30, "test data", "unknown", chatbrains.StopUnknown},
+        {"Filtered", 30, "test crap", "test", chatbrains.StopFiltered},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(1, table.lengthLimit)
+        brain.Train(table.message)
+
+        got, err := brain.GenerateDetailed(table.prompt)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if got.StopReason != table.expected {
+            t.Errorf("FAIL, expected stop reason: %v, got: %#v", table.expected, got)
+        } else if len(got.Probabilities) != len(got.Tokens) || got.Text != strings.Join(got.Tokens, "") {
+            t.Errorf("FAIL, expected a probability for each token of the text, got: %#v", got)
+        } else if !reflect.DeepEqual(got.Subject, []string{table.prompt}) {
+            t.Errorf("FAIL, expected subject: %#v, got: %#v", table.prompt, got.Subject)
+        } else if got.Probability() <= 0 || got.Probability() > 1 {
+            t.Errorf("FAIL, expected a probability between 0 and 1, got: %v", got.Probability())
+        } else if got.Duration <= 0 {
+            t.Errorf("FAIL, expected a duration, got: %v", got.Duration)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestExplain(t *testing.T) {
+    brain := new(Brain)
+    //Long enough that it's sure to reach an end token
+    brain.Init(1, 200)
+    brain.Train("data test data")
+    brain.Train("node test")
+
+    got, err := brain.Explain("test")
+    if err != nil {
+        t.Fatalf("FAIL, unexpected error: %v", err)
+    }
+    if got.Trace == nil || len(got.Trace.Steps) == 0 {
+        t.Fatalf("FAIL, expected a trace, got: %#v", got)
+    }
+
+    chains := map[string]bool{}
+    for _, step := range got.Trace.Steps {
+        if step.Note != "" {
+            continue
+        }
+        if _, ok := step.Candidates[step.Chosen]; !ok {
+            t.Errorf("FAIL, expected %#v to be a candidate, got: %#v", step.Chosen, step)
+        }
+        chains[step.Chain] = true
+    }
+    if !chains["backward"] || !chains["forward"] || len(chains) != 2 {
+        t.Errorf("FAIL, expected steps from both chains, got: %#v", chains)
+    }
+    if last := got.Trace.Steps[len(got.Trace.Steps)-1]; last.Stop != got.StopReason || last.Chain != "forward" {
+        t.Errorf("FAIL, expected the forward chain to stop with %v, got: %#v", got.StopReason, last)
+    }
+
+    if _, err := got.Trace.JSON(); err != nil {
+        t.Errorf("FAIL, unable to export trace as JSON: %v", err)
+    }
+    var b bytes.Buffer
+    if err := got.Trace.WriteTable(&b); err != nil {
+        t.Errorf("FAIL, unable to export trace as a table: %v", err)
+    }
+}
+
+func TestStats(t *testing.T) {
+    brain := new(Brain)
+    brain.Init(1, 30)
+    brain.Train("test data")
+    brain.Train("test node")
+
+    got := brain.Stats()
+    if got.Forward.Vocabulary != 4 || got.Backward.Vocabulary != 4 {
+        t.Errorf("FAIL, expected 4 tokens in each chain, got: %#v", got)
+    }
+    //Both chains see every transition, just in opposite directions
+    if got.Forward.TotalCount != 8 || got.Backward.TotalCount != 8 {
+        t.Errorf("FAIL, expected 8 transitions in each chain, got: %#v", got)
+    }
+    if got := brain.StatsTop(1); len(got.Forward.TopTokens) != 1 || len(got.Backward.TopTokens) != 1 {
+        t.Errorf("FAIL, expected only the top token of each chain, got: %#v", got)
+    }
+}
+
+//benchBrains calls fn with a brain trained on each corpus at each order
+func benchBrains(b *testing.B, fn func(b *testing.B, brain *Brain, messages []string)) {
+    for _, corpus := range benchdata.Corpora(b) {
+        for _, order := range benchdata.Orders {
+            brain := new(Brain)
+            brain.Init(order, 30)
+            for _, message := range corpus.Messages {
+                brain.Train(message)
+            }
+            messages := corpus.Messages
+            b.Run(fmt.Sprintf("%s/order-%d", corpus.Name, order), func(b *testing.B) {
+                fn(b, brain, messages)
+            })
+        }
+    }
+}
+
+func BenchmarkTrain(b *testing.B) {
+    for _, corpus := range benchdata.Corpora(b) {
+        for _, order := range benchdata.Orders {
+            messages := corpus.Messages
+            b.Run(fmt.Sprintf("%s/order-%d", corpus.Name, order), func(b *testing.B) {
+                brain := new(Brain)
+                brain.Init(order, 30)
+                b.ResetTimer()
+                for i := 0; i < b.N; i++ {
+                    brain.Train(messages[i%len(messages)])
+                }
+            })
+        }
+    }
+}
+
+func BenchmarkGenerate(b *testing.B) {
+    benchBrains(b, func(b *testing.B, brain *Brain, messages []string) {
+        for i := 0; i < b.N; i++ {
+            brain.Generate(messages[i%len(messages)])
+        }
+    })
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+    benchBrains(b, func(b *testing.B, brain *Brain, messages []string) {
+        for i := 0; i < b.N; i++ {
+            saved, err := brain.MarshalJSON()
+            if err != nil {
+                b.Fatalf("FAIL, unable to marshal brain: %v", err)
+            }
+            b.SetBytes(int64(len(saved)))
+        }
+    })
+}
+
+func BenchmarkUnmarshalJSON(b *testing.B) {
+    benchBrains(b, func(b *testing.B, brain *Brain, messages []string) {
+        saved, err := brain.MarshalJSON()
+        if err != nil {
+            b.Fatalf("FAIL, unable to marshal brain: %v", err)
+        }
+        b.SetBytes(int64(len(saved)))
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+            if err := new(Brain).UnmarshalJSON(saved); err != nil {
+                b.Fatalf("FAIL, unable to unmarshal brain: %v", err)
+            }
+        }
+    })
+}
@@ -0,0 +1,206 @@
+//Package ensemble blends several brains into one, so that a small
+//chat-specific brain can be mixed with a larger general one without
+//retraining either
+package ensemble
+
+import (
+    "fmt"
+    "github.com/TwinProduction/go-away"
+	log "github.com/sirupsen/logrus"
+    "math/rand"
+    "sort"
+	"strings"
+    chatbrains "github.com/MattChubb/chatbrains"
+    markov "github.com/MattChubb/chatbrains/markov"
+    "github.com/MattChubb/chatbrains/markovchain"
+)
+
+//Mode is how an ensemble combines its members when generating
+type Mode int
+
+const (
+    //Pick chooses one member at random, in proportion to its weight, to
+    //generate the whole reply
+    Pick Mode = iota
+    //Interpolate mixes every member's next token probabilities, in proportion
+    //to their weights, at each step of generation. Every member must be a
+    //Predictor.
+    Interpolate
+)
+
+//Predictor is implemented by brains that can say which tokens are likely to
+//come next, which is needed to interpolate between them
+type Predictor interface {
+    Order() int
+    Successors(context []string) map[string]int
+}
+
+type member struct {
+    brain  chatbrains.Brain
+    weight float64
+}
+
+//Brain is an ensemble of weighted brains. It doesn't learn anything itself;
+//Train trains every member.
+type Brain struct {
+    members     []member
+    mode        Mode
+    lengthLimit int
+}
+
+//Init sets the length limit for interpolated replies. The order is ignored,
+//as each member has its own.
+func (brain *Brain) Init(order int, lengthLimit int) {
+    brain.members = []member{}
+    brain.lengthLimit = lengthLimit
+    log.Debug("Braindump: ", brain)
+}
+
+//SetMode sets how members are combined when generating
+func (brain *Brain) SetMode(mode Mode) error {
+    if mode == Interpolate {
+        for _, m := range brain.members {
+            if _, ok := m.brain.(Predictor); !ok {
+                return fmt.Errorf("Unable to interpolate with a %T", m.brain)
+            }
+        }
+    }
+    brain.mode = mode
+    return nil
+}
+
+//Add adds a member to the ensemble. Weights are relative to the other
+//members' weights.
+func (brain *Brain) Add(child chatbrains.Brain, weight float64) error {
+    if weight <= 0 {
+        return fmt.Errorf("Member weight must be positive, got %v", weight)
+    }
+    if _, ok := child.(Predictor); !ok && brain.mode == Interpolate {
+        return fmt.Errorf("Unable to interpolate with a %T", child)
+    }
+    brain.members = append(brain.members, member{child, weight})
+    return nil
+}
+
+//Train trains every member on data
+func (brain *Brain) Train(data string) error {
+    for _, m := range brain.members {
+        if err := m.brain.Train(data); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (brain *Brain) Generate(prompt string) (string, error) {
+    if len(brain.members) == 0 {
+        return "", fmt.Errorf("Ensemble has no members")
+    }
+    if brain.mode == Interpolate {
+        return brain.interpolate(prompt)
+    }
+    return brain.pick().Generate(prompt)
+}
+
+//pick chooses a member at random, in proportion to their weights
+func (brain *Brain) pick() chatbrains.Brain {
+    total := 0.0
+    for _, m := range brain.members {
+        total += m.weight
+    }
+    r := rand.Float64() * total
+    for _, m := range brain.members {
+        r -= m.weight
+        if r < 0 {
+            return m.brain
+        }
+    }
+    return brain.members[len(brain.members)-1].brain
+}
+
+func (brain *Brain) interpolate(prompt string) (string, error) {
+    log.Debug("Input: ", prompt)
+    processedPrompt := chatbrains.ProcessString(prompt)
+    log.Debug("Processed into: ", processedPrompt)
+
+    order := 0
+    for _, m := range brain.members {
+        if o := m.brain.(Predictor).Order(); o > order {
+            order = o
+        }
+    }
+
+	subject := []string{}
+	if len(processedPrompt) > 0 {
+		subject = chatbrains.ExtractSubject(processedPrompt, order)
+	}
+    tokens := markov.GenerateInitialToken(subject, order)
+    log.Debug("Initial token: ", tokens)
+
+	for tokens[len(tokens)-1] != markovchain.EndToken &&
+		len(tokens) < brain.lengthLimit {
+        tokens = append(tokens, brain.nextToken(tokens))
+	}
+
+	//Don't include the start or end token in our response
+    sentence := []string{}
+    for _, token := range tokens {
+        if token != markovchain.StartToken && token != markovchain.EndToken {
+            sentence = append(sentence, token)
+        }
+    }
+    if len(sentence) == 0 {
+        return "", nil
+    }
+    sentence[0] = strings.Title(sentence[0])
+    return strings.Join(sentence, ""), nil
+}
+
+//nextToken samples the next token from every member's distribution, mixed
+//by weight. Members that have never seen the context are left out.
+func (brain *Brain) nextToken(tokens []string) string {
+    probabilities := make(map[string]float64)
+    total := 0.0
+    for _, m := range brain.members {
+        successors := m.brain.(Predictor).Successors(tokens)
+        sum := 0
+        for _, count := range successors {
+            sum += count
+        }
+        if sum == 0 {
+            continue
+        }
+        for next, count := range successors {
+            probabilities[next] += m.weight * float64(count) / float64(sum)
+        }
+        total += m.weight
+    }
+    log.Debug("Candidates: ", probabilities)
+    if total == 0 {
+        return markovchain.EndToken
+    }
+
+    //Go through candidates in a fixed order, so the same random numbers
+    //always give the same reply
+    candidates := make([]string, 0, len(probabilities))
+    for next := range probabilities {
+        candidates = append(candidates, next)
+    }
+    sort.Strings(candidates)
+
+    next := candidates[len(candidates)-1]
+    r := rand.Float64() * total
+    for _, candidate := range candidates {
+        r -= probabilities[candidate]
+        if r < 0 {
+            next = candidate
+            break
+        }
+    }
+
+    //TODO Implement a replacement wordfilter instead of just removing profanity
+    if goaway.IsProfane(next) {
+        return markovchain.EndToken
+    }
+    return next
+}
@@ -0,0 +1,135 @@
+package ensemble
+
+import (
+    "regexp"
+    "testing"
+    chatbrains "github.com/MattChubb/chatbrains"
+    "github.com/MattChubb/chatbrains/doublemarkov"
+    "github.com/MattChubb/chatbrains/markov"
+)
+
+//parrot just repeats the last thing it was trained on, and can't predict
+type parrot struct {
+    last string
+}
+
+func (brain *parrot) Init(order int, lengthLimit int) {}
+
+func (brain *parrot) Train(data string) error {
+    brain.last = data
+    return nil
+}
+
+func (brain *parrot) Generate(prompt string) (string, error) {
+    return brain.last, nil
+}
+
+func newEnsemble(t *testing.T, mode Mode) *Brain {
+    general := new(markov.Brain)
+    general.Init(1, 32)
+    general.Train("test data test data")
+    general.Train("data test data")
+
+    chat := new(doublemarkov.Brain)
+    chat.Init(2, 32)
+    chat.Train("test chat test")
+
+    brain := new(Brain)
+    brain.Init(0, 32)
+    if err := brain.SetMode(mode); err != nil {
+        t.Fatalf("FAIL, unable to set mode: %v", err)
+    }
+    if err := brain.Add(general, 1); err != nil {
+        t.Fatalf("FAIL, unable to add member: %v", err)
+    }
+    if err := brain.Add(chat, 3); err != nil {
+        t.Fatalf("FAIL, unable to add member: %v", err)
+    }
+    return brain
+}
+
+func TestGenerate(t *testing.T) {
+    tables := []struct {
+        testcase string
+        mode     Mode
+        input    string
+        expected string
+    }{
+        {"Pick, empty string", Pick, "", `^((Test)|(Data)|(Chat))((test)|(data)|(chat)| )*$`},
+        {"Pick, 1 word", Pick, "test", `^((Test)|(Data)|(Chat))((test)|(data)|(chat)| )*$`},
+        {"Interpolate, empty string", Interpolate, "", `^((Test)|(Data)|(Chat))((test)|(data)|(chat)| )*$`},
+        {"Interpolate, 1 word", Interpolate, "test", `^Test((test)|(data)|(chat)| )*$`},
+        {"Interpolate, unknown word", Interpolate, "testing", `^Testing$`},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := newEnsemble(t, table.mode)
+
+        got, err := brain.Generate(table.input)
+        t.Logf("Got: %s", got)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if match, _ := regexp.Match(table.expected, []byte(got)); !match {
+            t.Errorf("FAIL, expected: %s, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestGenerateEmpty(t *testing.T) {
+    brain := new(Brain)
+    brain.Init(0, 32)
+    if _, err := brain.Generate("test"); err == nil {
+        t.Errorf("FAIL, expected an error generating from an empty ensemble")
+    }
+}
+
+func TestTrain(t *testing.T) {
+    brain := new(Brain)
+    brain.Init(0, 32)
+    first, second := new(parrot), new(parrot)
+    brain.Add(first, 1)
+    brain.Add(second, 1)
+
+    if err := brain.Train("test data"); err != nil {
+        t.Errorf("FAIL, unexpected error: %v", err)
+    } else if first.last != "test data" || second.last != "test data" {
+        t.Errorf("FAIL, expected every member to be trained, got: %#v and %#v", first, second)
+    }
+}
+
+func TestAdd(t *testing.T) {
+    tables := []struct {
+        testcase string
+        mode     Mode
+        member   chatbrains.Brain
+        weight   float64
+        errors   bool
+    }{
+        {"Pick", Pick, new(parrot), 1, false},
+        {"Interpolate", Interpolate, new(markov.Brain), 0.5, false},
+        {"Interpolate, can't predict", Interpolate, new(parrot), 1, true},
+        {"Zero weight", Pick, new(parrot), 0, true},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(0, 32)
+        brain.SetMode(table.mode)
+        if err := brain.Add(table.member, table.weight); (err != nil) != table.errors {
+            t.Errorf("FAIL, expected errors: %v, got: %v", table.errors, err)
+        } else {
+            t.Log("Passed")
+        }
+    }
+
+    brain := new(Brain)
+    brain.Init(0, 32)
+    brain.Add(new(parrot), 1)
+    if err := brain.SetMode(Interpolate); err == nil {
+        t.Errorf("FAIL, expected an error interpolating with a member that can't predict")
+    }
+}
@@ -0,0 +1,213 @@
+//Package evaluation measures how well a brain models held-out messages it
+//wasn't trained on, so that configurations like order and length limits can
+//be compared objectively
+package evaluation
+
+import (
+    "fmt"
+    "math"
+    "time"
+    chatbrains "github.com/MattChubb/chatbrains"
+    markov "github.com/MattChubb/chatbrains/markov"
+    "github.com/MattChubb/chatbrains/markovchain"
+)
+
+//DefaultSmoothing is the count added to every possible next token, so that
+//held-out messages with transitions the brain has never seen still have a
+//probability
+const DefaultSmoothing = 0.1
+
+//Model is implemented by brains that can be evaluated, like markov.Brain and
+//doublemarkov.Brain. A doublemarkov brain is evaluated on its forward chain.
+type Model interface {
+    Order() int
+    Successors(context []string) map[string]int
+    Vocabulary() []string
+    Generate(prompt string) (string, error)
+}
+
+//Processor is implemented by models that tokenise messages their own way,
+//such as brains that redact personal information. Held-out messages are
+//tokenised the same way, or with ProcessString for other models.
+type Processor interface {
+    Process(text string) []string
+}
+
+//process splits message into tokens the way model was trained
+func process(model Model, message string) []string {
+    if processor, ok := model.(Processor); ok {
+        return processor.Process(message)
+    }
+    return chatbrains.ProcessString(message)
+}
+
+//Options configures an evaluation. Zero values are replaced by defaults.
+type Options struct {
+    //Smoothing is the count added to every possible next token
+    Smoothing float64
+    //Replies is how many held-out messages to generate replies to, or all
+    //of them if it's 0
+    Replies int
+}
+
+//Result is how well a brain modelled a held-out set of messages
+type Result struct {
+    Messages int
+    //Tokens is how many tokens were predicted, including the end of each
+    //message
+    Tokens int
+    //CrossEntropy is the average number of bits needed per token, and
+    //Perplexity is 2 to the power of it: roughly how many tokens the brain
+    //was choosing between at each step. Lower is better for both.
+    CrossEntropy float64
+    Perplexity   float64
+    //Unseen is how many transitions the brain had never seen, and only
+    //predicted thanks to smoothing
+    Unseen int
+    //Coverage is the fraction of distinct words in the held-out messages
+    //that the brain knows, and OutOfVocabulary the words it doesn't
+    Coverage        float64
+    OutOfVocabulary []string
+    Replies         ReplyStats
+}
+
+//ReplyStats summarises the replies a brain gave to held-out messages
+type ReplyStats struct {
+    Replies  int
+    Empty    int
+    Errors   int
+    //Distinct is the fraction of replies that were different from every
+    //other reply
+    Distinct     float64
+    MeanWords    float64
+    MeanChars    float64
+    MeanDuration time.Duration
+}
+
+//Evaluate measures how well model predicts the held-out messages, and how
+//it replies to them
+func Evaluate(model Model, heldOut []string, options Options) (Result, error) {
+    if len(heldOut) == 0 {
+        return Result{}, fmt.Errorf("No held-out messages to evaluate with")
+    }
+    if options.Smoothing <= 0 {
+        options.Smoothing = DefaultSmoothing
+    }
+    if options.Replies <= 0 || options.Replies > len(heldOut) {
+        options.Replies = len(heldOut)
+    }
+
+    result := CrossEntropy(model, heldOut, options.Smoothing)
+    result.Coverage, result.OutOfVocabulary = Coverage(model, heldOut)
+    result.Replies = Replies(model, heldOut[:options.Replies])
+    return result, nil
+}
+
+//CrossEntropy works out the cross-entropy and perplexity of model on the
+//held-out messages, using add-k smoothing with k of smoothing. Only
+//Messages, Tokens, CrossEntropy, Perplexity and Unseen are filled in.
+func CrossEntropy(model Model, heldOut []string, smoothing float64) Result {
+    order := model.Order()
+    //Every token the brain knows, plus the end token and anything unknown
+    outcomes := float64(len(model.Vocabulary()) + 2)
+
+    result := Result{Messages: len(heldOut)}
+    bits := 0.0
+    for _, message := range heldOut {
+        tokens := markov.GenerateInitialToken([]string{}, order)
+        tokens = append(tokens, process(model, message)...)
+        tokens = append(tokens, markovchain.EndToken)
+
+        for i := order; i < len(tokens); i++ {
+            successors := model.Successors(tokens[i-order : i])
+            total := 0
+            for _, count := range successors {
+                total += count
+            }
+            count := successors[tokens[i]]
+            if count == 0 {
+                result.Unseen++
+            }
+
+            probability := (float64(count) + smoothing) / (float64(total) + smoothing*outcomes)
+            bits -= math.Log2(probability)
+            result.Tokens++
+        }
+    }
+
+    if result.Tokens > 0 {
+        result.CrossEntropy = bits / float64(result.Tokens)
+        result.Perplexity = math.Pow(2, result.CrossEntropy)
+    }
+    return result
+}
+
+//Coverage returns the fraction of distinct words in the held-out messages
+//that model knows, along with those it doesn't
+func Coverage(model Model, heldOut []string) (float64, []string) {
+    known := make(map[string]bool)
+    for _, token := range model.Vocabulary() {
+        known[token] = true
+    }
+
+    seen := make(map[string]bool)
+    unknown := []string{}
+    for _, message := range heldOut {
+        for _, token := range chatbrains.Keywords(process(model, message)) {
+            if seen[token] {
+                continue
+            }
+            seen[token] = true
+            if !known[token] {
+                unknown = append(unknown, token)
+            }
+        }
+    }
+
+    if len(seen) == 0 {
+        return 1, unknown
+    }
+    return float64(len(seen)-len(unknown)) / float64(len(seen)), unknown
+}
+
+//Replies generates a reply to each prompt, and summarises them
+func Replies(model Model, prompts []string) ReplyStats {
+    stats := ReplyStats{}
+    counts := make(map[string]int)
+    words := 0
+    chars := 0
+    var elapsed time.Duration
+    for _, prompt := range prompts {
+        started := time.Now()
+        reply, err := model.Generate(prompt)
+        elapsed += time.Since(started)
+        if err != nil {
+            stats.Errors++
+            continue
+        }
+
+        stats.Replies++
+        if reply == "" {
+            stats.Empty++
+        }
+        counts[reply]++
+        words += chatbrains.CountWords(chatbrains.ProcessString(reply))
+        chars += len([]rune(reply))
+    }
+
+    if stats.Replies > 0 {
+        distinct := 0
+        for _, count := range counts {
+            if count == 1 {
+                distinct++
+            }
+        }
+        stats.Distinct = float64(distinct) / float64(stats.Replies)
+        stats.MeanWords = float64(words) / float64(stats.Replies)
+        stats.MeanChars = float64(chars) / float64(stats.Replies)
+    }
+    if len(prompts) > 0 {
+        stats.MeanDuration = elapsed / time.Duration(len(prompts))
+    }
+    return stats
+}
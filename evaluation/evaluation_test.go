@@ -0,0 +1,117 @@
+package evaluation
+
+import (
+    "math"
+    "reflect"
+    "testing"
+    doublemarkov "github.com/MattChubb/chatbrains/doublemarkov"
+    chatbrains "github.com/MattChubb/chatbrains"
+    markov "github.com/MattChubb/chatbrains/markov"
+)
+
+//Both brains should be usable as models
+var _ Model = new(markov.Brain)
+var _ Model = new(doublemarkov.Brain)
+var _ Processor = new(markov.Brain)
+var _ Processor = new(doublemarkov.Brain)
+
+func newBrain(order int, messages ...string) *markov.Brain {
+    brain := new(markov.Brain)
+    brain.Init(order, 30)
+    for _, message := range messages {
+        brain.Train(message)
+    }
+    return brain
+}
+
+func TestCrossEntropy(t *testing.T) {
+    brain := newBrain(1, "test")
+    got := CrossEntropy(brain, []string{"test"}, 0.1)
+
+    //Both transitions were seen once, out of "test", the end token and
+    //anything unknown
+    expected := -math.Log2(1.1 / 1.3)
+    if got.Messages != 1 || got.Tokens != 2 || got.Unseen != 0 {
+        t.Errorf("FAIL, expected 1 message and 2 seen tokens, got: %#v", got)
+    } else if math.Abs(got.CrossEntropy-expected) > 1e-9 || math.Abs(got.Perplexity-math.Pow(2, expected)) > 1e-9 {
+        t.Errorf("FAIL, expected cross-entropy: %v, got: %#v", expected, got)
+    }
+}
+
+func TestCrossEntropyCompare(t *testing.T) {
+    heldOut := []string{"the cat sat on the mat", "the dog sat on the log"}
+    tables := []struct {
+        testcase string
+        better   *markov.Brain
+        worse    *markov.Brain
+    }{
+        {"Related training", newBrain(1, "the cat sat on the log", "the dog sat on the mat"), newBrain(1, "stocks fell sharply today")},
+        {"More training", newBrain(1, "the cat sat on the mat", "the dog sat on the log"), newBrain(1, "the cat sat")},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        better := CrossEntropy(table.better, heldOut, DefaultSmoothing)
+        worse := CrossEntropy(table.worse, heldOut, DefaultSmoothing)
+        if better.Perplexity >= worse.Perplexity || better.Unseen >= worse.Unseen {
+            t.Errorf("FAIL, expected %#v to be better than %#v", better, worse)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestCoverage(t *testing.T) {
+    brain := newBrain(1, "test data")
+    coverage, unknown := Coverage(brain, []string{"test node", "node"})
+    if coverage != 0.5 || !reflect.DeepEqual(unknown, []string{"node"}) {
+        t.Errorf("FAIL, expected half coverage without node, got: %v, %#v", coverage, unknown)
+    }
+}
+
+func TestRedactingModel(t *testing.T) {
+    brain := new(markov.Brain)
+    brain.Init(1, 30)
+    brain.SetRedactor(chatbrains.NewRedactor())
+    brain.Train("mail jo@example.com")
+
+    //Held-out messages should be redacted as the training messages were
+    heldOut := []string{"mail sam@example.org"}
+    if got := CrossEntropy(brain, heldOut, DefaultSmoothing); got.Tokens != 4 || got.Unseen != 0 {
+        t.Errorf("FAIL, expected 4 seen tokens, got: %#v", got)
+    } else if coverage, unknown := Coverage(brain, heldOut); coverage != 1 || len(unknown) != 0 {
+        t.Errorf("FAIL, expected full coverage, got: %v, %#v", coverage, unknown)
+    } else {
+        t.Log("Passed")
+    }
+}
+
+func TestReplies(t *testing.T) {
+    brain := newBrain(1, "test")
+    got := Replies(brain, []string{"test", "test"})
+    if got.Replies != 2 || got.Empty != 0 || got.Errors != 0 {
+        t.Errorf("FAIL, expected 2 replies, got: %#v", got)
+    } else if got.MeanWords != 1 || got.MeanChars != 4 || got.Distinct != 0 {
+        t.Errorf("FAIL, expected the same one word reply twice, got: %#v", got)
+    }
+}
+
+func TestEvaluate(t *testing.T) {
+    brain := new(doublemarkov.Brain)
+    brain.Init(1, 30)
+    brain.Train("test data")
+
+    if _, err := Evaluate(brain, []string{}, Options{}); err == nil {
+        t.Errorf("FAIL, expected an error without held-out messages")
+    }
+
+    got, err := Evaluate(brain, []string{"test data", "data test", "node"}, Options{Replies: 2})
+    if err != nil {
+        t.Fatalf("FAIL, unexpected error: %v", err)
+    }
+    if got.Messages != 3 || got.Replies.Replies != 2 || got.Perplexity <= 1 {
+        t.Errorf("FAIL, expected 3 messages evaluated and 2 replies, got: %#v", got)
+    } else if got.Coverage != 2.0/3 {
+        t.Errorf("FAIL, expected two thirds coverage, got: %v", got.Coverage)
+    }
+}
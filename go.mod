@@ -5,6 +5,5 @@ go 1.15
 require (
 	github.com/MattChubb/telegram-bot-go v0.0.0-20210201213959-b92b0797bff4
 	github.com/TwinProduction/go-away v1.1.0
-	github.com/mb-14/gomarkov v0.0.0-20210216094942-a5b484cc0243
 	github.com/sirupsen/logrus v1.8.0
 )
@@ -0,0 +1,61 @@
+package importers
+
+import (
+    "bufio"
+    "encoding/json"
+    "io"
+    "time"
+    chatbrains "github.com/MattChubb/chatbrains"
+)
+
+//Discord reads the JSON written by DiscordChatExporter
+type Discord struct {
+    //IncludeBots trains on messages from bots as well as people
+    IncludeBots bool
+}
+
+type discordMessage struct {
+    Type      string
+    Timestamp time.Time
+    Content   string
+    Author    struct {
+        ID    string
+        Name  string
+        IsBot bool
+    }
+}
+
+func (importer Discord) Import(r io.Reader, fn func(chatbrains.Message) error) error {
+    decoder := json.NewDecoder(bufio.NewReader(r))
+    chatID := ""
+    return chatbrains.DecodeObject(decoder, func(key string) error {
+        switch key {
+        case "channel":
+            var channel struct{ ID string }
+            err := decoder.Decode(&channel)
+            chatID = channel.ID
+            return err
+        case "messages":
+            return decodeArray(decoder, func() error {
+                var message discordMessage
+                if err := decoder.Decode(&message); err != nil {
+                    return err
+                }
+                //Everything else is joins, pins, calls and the like
+                if message.Type != "Default" && message.Type != "Reply" {
+                    return nil
+                }
+                if message.Author.IsBot && !importer.IncludeBots {
+                    return nil
+                }
+
+                return fn(chatbrains.Message{
+                    Text: message.Content,
+                    Meta: chatbrains.Meta{AuthorID: message.Author.ID, ChatID: chatID, Time: message.Timestamp},
+                })
+            })
+        default:
+            return chatbrains.SkipValue(decoder)
+        }
+    })
+}
@@ -0,0 +1,54 @@
+package importers
+
+import (
+    "testing"
+    "time"
+    chatbrains "github.com/MattChubb/chatbrains"
+)
+
+func TestDiscord(t *testing.T) {
+    when := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+    input := `{"guild":{"id":"1","name":"Test"},"channel":{"id":"42","type":"GuildTextChat","name":"general"},"messages":[
+        {"id":"1","type":"Default","timestamp":"2021-01-01T12:00:00+00:00","content":"test data","author":{"id":"100","name":"alice","isBot":false}},
+        {"id":"2","type":"ChannelPinnedMessage","timestamp":"2021-01-01T12:00:00+00:00","content":"Pinned a message.","author":{"id":"100","name":"alice","isBot":false}},
+        {"id":"3","type":"Reply","timestamp":"2021-01-01T12:00:00+00:00","content":"data test","author":{"id":"200","name":"bob","isBot":false}},
+        {"id":"4","type":"Default","timestamp":"2021-01-01T12:00:00+00:00","content":"beep","author":{"id":"300","name":"bot","isBot":true}}
+    ],"messageCount":4}`
+
+    tables := []struct {
+        testcase string
+        importer Discord
+        expected []chatbrains.Message
+    }{
+        {"Without bots", Discord{}, []chatbrains.Message{
+            message("test data", "100", "42", when),
+            message("data test", "200", "42", when),
+        }},
+        {"With bots", Discord{IncludeBots: true}, []chatbrains.Message{
+            message("test data", "100", "42", when),
+            message("data test", "200", "42", when),
+            message("beep", "300", "42", when),
+        }},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        got, err := collect(t, table.importer, input)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if len(got) != len(table.expected) {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+        } else {
+            for i := range got {
+                if got[i].Text != table.expected[i].Text || got[i].AuthorID != table.expected[i].AuthorID || got[i].ChatID != table.expected[i].ChatID || !got[i].Time.Equal(table.expected[i].Time) {
+                    t.Errorf("FAIL, expected: %#v, got: %#v", table.expected[i], got[i])
+                }
+            }
+            t.Log("Passed")
+        }
+    }
+
+    if _, err := collect(t, Discord{}, `{"messages":{}}`); err == nil {
+        t.Errorf("FAIL, expected an error for malformed messages")
+    }
+}
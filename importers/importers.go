@@ -0,0 +1,62 @@
+//Package importers reads messages out of chat exports, so that brains can be
+//bootstrapped from a chat's history
+package importers
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    chatbrains "github.com/MattChubb/chatbrains"
+)
+
+//Importer reads the messages out of one kind of chat export
+type Importer interface {
+    //Import calls fn with every message in r, skipping service messages
+    //such as joins, pins and calls
+    Import(r io.Reader, fn func(chatbrains.Message) error) error
+}
+
+//Train trains brain on every message importer finds in r. If the brain can
+//record where messages came from, their authors are recorded too. Token
+//counts are the brain's own if it's a chatbrains.MessageTrainer. progress,
+//if not nil, is called every chatbrains.ProgressInterval messages.
+func Train(brain chatbrains.Brain, r io.Reader, importer Importer, progress func(chatbrains.TrainStats)) (chatbrains.TrainStats, error) {
+    read := func(fn func(chatbrains.Message) error) error {
+        return importer.Import(r, fn)
+    }
+
+    return chatbrains.TrainMessages(read, progress, func(data string, meta *chatbrains.Meta) (int, error) {
+        if trainer, ok := brain.(chatbrains.MessageTrainer); ok {
+            return trainer.TrainMessage(data, meta)
+        }
+        var err error
+        if trainer, ok := brain.(chatbrains.MetaTrainer); ok && meta != nil {
+            err = trainer.TrainWithMeta(data, *meta)
+        } else {
+            err = brain.Train(data)
+        }
+        return len(chatbrains.ProcessString(data)), err
+    })
+}
+
+//decodeArray reads a JSON array from decoder one element at a time, calling
+//decodeValue for each. decodeValue must consume the element.
+func decodeArray(decoder *json.Decoder, decodeValue func() error) error {
+    token, err := decoder.Token()
+    if err != nil {
+        return err
+    }
+    if delim, ok := token.(json.Delim); !ok || delim != '[' {
+        return fmt.Errorf("Expected JSON array, got %v", token)
+    }
+
+    for decoder.More() {
+        if err := decodeValue(); err != nil {
+            return err
+        }
+    }
+
+    //Consume the closing bracket
+    _, err = decoder.Token()
+    return err
+}
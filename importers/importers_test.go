@@ -0,0 +1,47 @@
+package importers
+
+import (
+    "strings"
+    "testing"
+    "time"
+    chatbrains "github.com/MattChubb/chatbrains"
+    "github.com/MattChubb/chatbrains/markov"
+)
+
+func TestTrain(t *testing.T) {
+    input := "31/12/2020, 23:59 - Alice: mail me@example.com\n" +
+        "31/12/2020, 23:59 - Bob: <Media omitted>\n" +
+        "31/12/2020, 23:59 - Bob: data test. test node\n"
+
+    tables := []struct {
+        testcase  string
+        configure func(brain *markov.Brain)
+        tokens    int
+    }{
+        {"Plain", func(brain *markov.Brain) {}, 14},
+        {"Redaction", func(brain *markov.Brain) { brain.SetRedactor(chatbrains.NewRedactor()) }, 10},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(markov.Brain)
+        brain.Init(1, 10)
+        table.configure(brain)
+        stats, err := Train(brain, strings.NewReader(input), WhatsApp{DayFirst: true}, nil)
+
+        expected := chatbrains.TrainStats{Messages: 2, Tokens: table.tokens}
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if stats != expected {
+            t.Errorf("FAIL, expected: %#v, got: %#v", expected, stats)
+        } else if n, err := brain.EraseAuthor("Bob"); n != 1 || err != nil {
+            t.Errorf("FAIL, expected Bob's message to be recorded, erased: %d (%v)", n, err)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func message(text string, authorID string, chatID string, when time.Time) chatbrains.Message {
+    return chatbrains.Message{Text: text, Meta: chatbrains.Meta{AuthorID: authorID, ChatID: chatID, Time: when}}
+}
@@ -0,0 +1,115 @@
+package importers
+
+import (
+    "bufio"
+    "encoding/json"
+    "io"
+    "strconv"
+    "strings"
+    "time"
+    chatbrains "github.com/MattChubb/chatbrains"
+)
+
+//Telegram reads the result.json written by Telegram Desktop, either for a
+//single chat or for a whole account
+type Telegram struct{}
+
+type telegramMessage struct {
+    Type         string
+    Date         string
+    DateUnixtime string `json:"date_unixtime"`
+    From         string
+    FromID       string `json:"from_id"`
+    Text         telegramText
+}
+
+//telegramText is either a plain string, or a list of strings and formatted
+//entities such as links and bold text
+type telegramText string
+
+func (text *telegramText) UnmarshalJSON(b []byte) error {
+    var plain string
+    if err := json.Unmarshal(b, &plain); err == nil {
+        *text = telegramText(plain)
+        return nil
+    }
+
+    var parts []json.RawMessage
+    if err := json.Unmarshal(b, &parts); err != nil {
+        return err
+    }
+    var builder strings.Builder
+    for _, part := range parts {
+        var entity struct{ Text string }
+        if err := json.Unmarshal(part, &plain); err == nil {
+            builder.WriteString(plain)
+        } else if err := json.Unmarshal(part, &entity); err == nil {
+            builder.WriteString(entity.Text)
+        } else {
+            return err
+        }
+    }
+    *text = telegramText(builder.String())
+    return nil
+}
+
+func (importer Telegram) Import(r io.Reader, fn func(chatbrains.Message) error) error {
+    decoder := json.NewDecoder(bufio.NewReader(r))
+    return importer.decodeChat(decoder, fn)
+}
+
+//decodeChat reads a chat, or a whole account export, which is a chat with
+//lists of other chats in it
+func (importer Telegram) decodeChat(decoder *json.Decoder, fn func(chatbrains.Message) error) error {
+    chatID := ""
+    return chatbrains.DecodeObject(decoder, func(key string) error {
+        switch key {
+        case "id":
+            var id json.Number
+            err := decoder.Decode(&id)
+            chatID = id.String()
+            return err
+        case "messages":
+            return decodeArray(decoder, func() error {
+                var message telegramMessage
+                if err := decoder.Decode(&message); err != nil {
+                    return err
+                }
+                if message.Type != "message" {
+                    return nil
+                }
+                return fn(message.toMessage(chatID))
+            })
+        case "chats", "left_chats":
+            return chatbrains.DecodeObject(decoder, func(key string) error {
+                if key != "list" {
+                    return chatbrains.SkipValue(decoder)
+                }
+                return decodeArray(decoder, func() error {
+                    return importer.decodeChat(decoder, fn)
+                })
+            })
+        default:
+            return chatbrains.SkipValue(decoder)
+        }
+    })
+}
+
+func (message telegramMessage) toMessage(chatID string) chatbrains.Message {
+    authorID := message.FromID
+    if authorID == "" {
+        authorID = message.From
+    }
+
+    var when time.Time
+    if unix, err := strconv.ParseInt(message.DateUnixtime, 10, 64); err == nil {
+        when = time.Unix(unix, 0)
+    } else if parsed, err := time.ParseInLocation("2006-01-02T15:04:05", message.Date, time.Local); err == nil {
+        when = parsed
+    }
+
+    return chatbrains.Message{
+        Text: string(message.Text),
+        Meta: chatbrains.Meta{AuthorID: authorID, ChatID: chatID, Time: when},
+    }
+}
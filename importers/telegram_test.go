@@ -0,0 +1,81 @@
+package importers
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+    chatbrains "github.com/MattChubb/chatbrains"
+)
+
+//collect runs importer over input and returns every message it found
+func collect(t *testing.T, importer Importer, input string) ([]chatbrains.Message, error) {
+    got := []chatbrains.Message{}
+    err := importer.Import(strings.NewReader(input), func(message chatbrains.Message) error {
+        got = append(got, message)
+        return nil
+    })
+    return got, err
+}
+
+func TestTelegram(t *testing.T) {
+    when := time.Unix(1609502400, 0)
+    tables := []struct {
+        testcase string
+        input    string
+        expected []chatbrains.Message
+        errors   bool
+    }{
+        {
+            "Single chat",
+            `{"name":"Test","type":"personal_chat","id":42,"messages":[
+                {"id":1,"type":"service","date":"2021-01-01T12:00:00","date_unixtime":"1609502400","actor":"Alice","action":"create_group"},
+                {"id":2,"type":"message","date":"2021-01-01T12:00:00","date_unixtime":"1609502400","from":"Alice","from_id":"user1","text":"test data"}
+            ]}`,
+            []chatbrains.Message{message("test data", "user1", "42", when)},
+            false,
+        },
+        {
+            "Formatted text",
+            `{"id":42,"messages":[
+                {"type":"message","date_unixtime":"1609502400","from_id":"user1","text":["test ",{"type":"bold","text":"data"}," test"]}
+            ]}`,
+            []chatbrains.Message{message("test data test", "user1", "42", when)},
+            false,
+        },
+        {
+            "Whole account",
+            `{"about":"...","personal_information":{"first_name":"Alice"},"chats":{"about":"...","list":[
+                {"id":1,"messages":[{"type":"message","date_unixtime":"1609502400","from_id":"user1","text":"test"}]},
+                {"id":2,"messages":[{"type":"message","date_unixtime":"1609502400","from_id":"user2","text":"data"}]}
+            ]},"left_chats":{"list":[
+                {"id":3,"messages":[{"type":"message","date_unixtime":"1609502400","from_id":"user3","text":"left"}]}
+            ]}}`,
+            []chatbrains.Message{
+                message("test", "user1", "1", when),
+                message("data", "user2", "2", when),
+                message("left", "user3", "3", when),
+            },
+            false,
+        },
+        {
+            "Old export without unix times",
+            `{"id":42,"messages":[{"type":"message","date":"2021-01-01T12:00:00","from":"Alice","text":"test"}]}`,
+            []chatbrains.Message{message("test", "Alice", "42", time.Date(2021, 1, 1, 12, 0, 0, 0, time.Local))},
+            false,
+        },
+        {"Not JSON", "test data", []chatbrains.Message{}, true},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        got, err := collect(t, Telegram{}, table.input)
+        if (err != nil) != table.errors {
+            t.Errorf("FAIL, expected errors: %v, got: %v", table.errors, err)
+        } else if !reflect.DeepEqual(got, table.expected) {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
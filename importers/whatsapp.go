@@ -0,0 +1,149 @@
+package importers
+
+import (
+    "bufio"
+    "io"
+    "regexp"
+    "strings"
+    "time"
+    chatbrains "github.com/MattChubb/chatbrains"
+)
+
+//WhatsApp reads the .txt written by WhatsApp's "Export chat", from either
+//Android or iOS
+type WhatsApp struct {
+    //DayFirst reads dates as day/month rather than month/day. Which one an
+    //export uses depends on the phone's locale.
+    DayFirst bool
+    //ChatID is recorded against every message, as exports don't include one
+    ChatID string
+}
+
+var (
+    //Android: "31/12/2020, 23:59 - Alice: Hello"
+    whatsAppAndroidLine = regexp.MustCompile(`^(\d{1,2}[/.]\d{1,2}[/.]\d{2,4}),? (\d{1,2}:\d{2}(?::\d{2})?(?: ?[APap]\.?[Mm]\.?)?) - (.*)$`)
+    //iOS: "[31/12/2020, 23:59:59] Alice: Hello"
+    whatsAppIOSLine = regexp.MustCompile(`^\[(\d{1,2}[/.]\d{1,2}[/.]\d{2,4}),? (\d{1,2}:\d{2}(?::\d{2})?(?: ?[APap]\.?[Mm]\.?)?)\] (.*)$`)
+    //Names can't have colons or quotes in, which system messages quoting
+    //a group's subject or description often do
+    whatsAppAuthor  = regexp.MustCompile(`^([^:"“”]+): (.*)$`)
+    //System messages say what someone did, like "Alice changed the subject"
+    whatsAppSystem  = regexp.MustCompile(`(?i)\b(?:changed|created|added|removed|left|joined|pinned|deleted|turned|started|ended|reset|updated)\b`)
+    whatsAppDate    = regexp.MustCompile(`^(\d{1,2})[/.](\d{1,2})[/.](\d{2,4})$`)
+)
+
+//Placeholders WhatsApp writes in place of things that aren't text
+var whatsAppOmitted = []string{
+    "<media omitted>",
+    "image omitted",
+    "video omitted",
+    "audio omitted",
+    "sticker omitted",
+    "gif omitted",
+    "document omitted",
+    "contact card omitted",
+    "this message was deleted",
+    "you deleted this message",
+    "null",
+}
+
+func (importer WhatsApp) Import(r io.Reader, fn func(chatbrains.Message) error) error {
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+    var pending *chatbrains.Message
+    flush := func() error {
+        if pending == nil {
+            return nil
+        }
+        message := *pending
+        pending = nil
+        if isWhatsAppOmitted(message.Text) {
+            return nil
+        }
+        return fn(message)
+    }
+
+    for scanner.Scan() {
+        line := cleanWhatsAppLine(scanner.Text())
+        match := whatsAppAndroidLine.FindStringSubmatch(line)
+        if match == nil {
+            match = whatsAppIOSLine.FindStringSubmatch(line)
+        }
+
+        if match == nil {
+            //Messages with line breaks carry on over several lines
+            if pending != nil {
+                pending.Text += "\n" + line
+            }
+            continue
+        }
+
+        if err := flush(); err != nil {
+            return err
+        }
+        author := whatsAppAuthor.FindStringSubmatch(match[3])
+        if author == nil || whatsAppSystem.MatchString(author[1]) {
+            //System messages like "Alice joined" don't have an author,
+            //though they can have a colon in
+            continue
+        }
+        pending = &chatbrains.Message{
+            Text: author[2],
+            Meta: chatbrains.Meta{AuthorID: author[1], ChatID: importer.ChatID, Time: importer.parseTime(match[1], match[2])},
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return err
+    }
+    return flush()
+}
+
+//parseTime turns an export's date and time into a time.Time, returning the
+//zero time if it can't make sense of them
+func (importer WhatsApp) parseTime(date string, clock string) time.Time {
+    parts := whatsAppDate.FindStringSubmatch(date)
+    if parts == nil {
+        return time.Time{}
+    }
+    day, month, year := parts[1], parts[2], parts[3]
+    if !importer.DayFirst {
+        day, month = month, day
+    }
+    if len(year) == 2 {
+        year = "20" + year
+    }
+    normalised := year + "-" + zeroPad(month) + "-" + zeroPad(day) + " " + strings.ToUpper(strings.Replace(clock, ".", "", -1))
+
+    for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02 3:04:05 PM", "2006-01-02 3:04 PM", "2006-01-02 3:04:05PM", "2006-01-02 3:04PM"} {
+        if when, err := time.ParseInLocation(layout, normalised, time.Local); err == nil {
+            return when
+        }
+    }
+    return time.Time{}
+}
+
+func cleanWhatsAppLine(line string) string {
+    //Exports are littered with direction marks and unusual spaces
+    line = strings.Replace(line, "\u200e", "", -1)
+    line = strings.Replace(line, "\u202f", " ", -1)
+    line = strings.Replace(line, "\u00a0", " ", -1)
+    return strings.TrimRight(line, "\r")
+}
+
+func isWhatsAppOmitted(text string) bool {
+    text = strings.ToLower(strings.TrimSpace(text))
+    for _, omitted := range whatsAppOmitted {
+        if text == omitted {
+            return true
+        }
+    }
+    return false
+}
+
+func zeroPad(s string) string {
+    if len(s) == 1 {
+        return "0" + s
+    }
+    return s
+}
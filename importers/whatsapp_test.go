@@ -0,0 +1,74 @@
+package importers
+
+import (
+    "reflect"
+    "testing"
+    "time"
+    chatbrains "github.com/MattChubb/chatbrains"
+)
+
+func TestWhatsApp(t *testing.T) {
+    when := time.Date(2020, 12, 31, 23, 59, 0, 0, time.Local)
+    tables := []struct {
+        testcase string
+        importer WhatsApp
+        input    string
+        expected []chatbrains.Message
+    }{
+        {
+            "Android",
+            WhatsApp{DayFirst: true, ChatID: "chat"},
+            "31/12/2020, 23:59 - Messages and calls are end-to-end encrypted.\n" +
+                "31/12/2020, 23:59 - Alice: test data\n" +
+                "31/12/2020, 23:59 - Bob: <Media omitted>\n" +
+                "31/12/2020, 23:59 - Bob joined using this group's invite link\n" +
+                "31/12/2020, 23:59 - Bob changed the subject from \"test\" to \"data: test\"\n" +
+                "31/12/2020, 23:59 - Bob changed the group description: test data\n" +
+                "31/12/2020, 23:59 - +44 7700 900123: data test\n",
+            []chatbrains.Message{message("test data", "Alice", "chat", when), message("data test", "+44 7700 900123", "chat", when)},
+        },
+        {
+            "Android, US dates",
+            WhatsApp{},
+            "12/31/20, 11:59 PM - Alice: test data\n",
+            []chatbrains.Message{message("test data", "Alice", "", when)},
+        },
+        {
+            "iOS",
+            WhatsApp{DayFirst: true},
+            "[31/12/2020, 23:59:00] Alice: test data\r\n" +
+                "\u200e[31/12/2020, 23:59:00] Bob: \u200eimage omitted\r\n" +
+                "[31/12/2020, 23:59:00] Bob: This message was deleted\r\n" +
+                "[31/12/2020, 23:59:00] Bob changed the subject to “data: test”\r\n",
+            []chatbrains.Message{message("test data", "Alice", "", when)},
+        },
+        {
+            "iOS, narrow spaces",
+            WhatsApp{},
+            "[12/31/20, 11:59:00\u202fPM] Alice: test data\n",
+            []chatbrains.Message{message("test data", "Alice", "", when)},
+        },
+        {
+            "Multi-line message",
+            WhatsApp{DayFirst: true},
+            "31/12/2020, 23:59 - Alice: test\ndata\n\n31/12/2020, 23:59 - Bob: data: test\n",
+            []chatbrains.Message{
+                message("test\ndata\n", "Alice", "", when),
+                message("data: test", "Bob", "", when),
+            },
+        },
+        {"Not an export", WhatsApp{}, "test data\n", []chatbrains.Message{}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        got, err := collect(t, table.importer, table.input)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if !reflect.DeepEqual(got, table.expected) {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
@@ -0,0 +1,74 @@
+//Package benchdata loads the corpora that brains are benchmarked against, so
+//that every package benchmarks against the same messages
+package benchdata
+
+import (
+    "bufio"
+    "fmt"
+    "math/rand"
+    "os"
+    "path/filepath"
+    "runtime"
+    "strings"
+    "testing"
+    log "github.com/sirupsen/logrus"
+)
+
+//Orders are the chain orders benchmarks are run at
+var Orders = []int{1, 2, 3, 4}
+
+//Corpus is a named set of messages to benchmark against
+type Corpus struct {
+    Name     string
+    Messages []string
+}
+
+//Corpora returns a synthetic corpus of random words, and a realistic one of
+//chat messages from testdata. Logging is turned down to warnings until b
+//finishes, as brains log at info level when saved, which would drown out the
+//results.
+func Corpora(b *testing.B) []Corpus {
+    level := log.GetLevel()
+    log.SetLevel(log.WarnLevel)
+    b.Cleanup(func() { log.SetLevel(level) })
+
+    return []Corpus{{"synthetic", Synthetic()}, {"realistic", Realistic(b)}}
+}
+
+//Synthetic returns 1000 messages of random words, Zipf distributed like
+//words in real text. It's the same every time.
+func Synthetic() []string {
+    r := rand.New(rand.NewSource(1))
+    zipf := rand.NewZipf(r, 1.1, 1, 499)
+    messages := make([]string, 1000)
+    for i := range messages {
+        words := make([]string, 3+r.Intn(18))
+        for j := range words {
+            words[j] = fmt.Sprintf("word%d", zipf.Uint64())
+        }
+        messages[i] = strings.Join(words, " ")
+    }
+    return messages
+}
+
+//Realistic returns the chat messages in testdata/chat.txt, one per line
+func Realistic(b *testing.B) []string {
+    //Found relative to this file, as benchmarks run in their own package's
+    //directory
+    _, file, _, _ := runtime.Caller(0)
+    f, err := os.Open(filepath.Join(filepath.Dir(file), "..", "..", "testdata", "chat.txt"))
+    if err != nil {
+        b.Fatalf("FAIL, unable to open corpus: %v", err)
+    }
+    defer f.Close()
+
+    messages := []string{}
+    scanner := bufio.NewScanner(f)
+    for scanner.Scan() {
+        messages = append(messages, scanner.Text())
+    }
+    if err := scanner.Err(); err != nil {
+        b.Fatalf("FAIL, unable to read corpus: %v", err)
+    }
+    return messages
+}
@@ -0,0 +1,17 @@
+package benchdata
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestSynthetic(t *testing.T) {
+    first := Synthetic()
+    if len(first) != 1000 {
+        t.Errorf("FAIL, expected 1000 messages, got: %d", len(first))
+    } else if !reflect.DeepEqual(first, Synthetic()) {
+        t.Errorf("FAIL, expected the same messages every time")
+    } else {
+        t.Log("Passed")
+    }
+}
@@ -0,0 +1,325 @@
+package brain
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "sync"
+    log "github.com/sirupsen/logrus"
+)
+
+//JournalEntry is a single record in a Journal. Most entries hold the
+//processed tokens that were added to a brain by one call to Train, but
+//anything else that changes a brain's counts is recorded too.
+type JournalEntry struct {
+    Tokens  []string   `json:",omitempty"`
+    Weight  int        `json:",omitempty"`
+    Meta    *Meta      `json:",omitempty"`
+    Untrain bool       `json:",omitempty"`
+    Decay   *DecayStep `json:",omitempty"`
+    Prune   int        `json:",omitempty"`
+}
+
+//Journal is an append-only log of everything a brain has been trained on
+//since its last snapshot. Replaying the journal over the snapshot restores
+//the brain, so a crash only loses what hadn't been written to the journal yet.
+//
+//Snapshots and journals are tagged with a generation number so that a crash
+//part way through compaction can't cause entries to be applied twice.
+type Journal struct {
+    snapshotPath string
+    compactEvery int
+    file         *os.File
+    generation   int
+    pending      int
+    lock         sync.Mutex
+}
+
+type journalHeader struct {
+    Generation int
+}
+
+type snapshotJSON struct {
+    Generation int
+    Brain      json.RawMessage
+}
+
+//OpenJournal opens (or creates) the journal at path. The brain is written to
+//snapshotPath every compactEvery entries; a compactEvery of 0 or less means
+//the journal is only compacted when Compact is called.
+func OpenJournal(path string, snapshotPath string, compactEvery int) (*Journal, error) {
+    file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+    if err != nil {
+        return nil, err
+    }
+
+    journal := &Journal{
+        snapshotPath: snapshotPath,
+        compactEvery: compactEvery,
+        file:         file,
+    }
+
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, err
+    }
+    if info.Size() == 0 {
+        generation, err := snapshotGeneration(snapshotPath)
+        if err != nil {
+            file.Close()
+            return nil, err
+        }
+        if err := journal.reset(generation); err != nil {
+            file.Close()
+            return nil, err
+        }
+    } else {
+        var header journalHeader
+        line, _ := bufio.NewReader(file).ReadBytes('\n')
+        if json.Unmarshal(line, &header) == nil {
+            journal.generation = header.Generation
+        }
+        if _, err := file.Seek(0, io.SeekEnd); err != nil {
+            file.Close()
+            return nil, err
+        }
+    }
+
+    return journal, nil
+}
+
+//LoadSnapshot loads the latest snapshot into brain. It returns false if no
+//snapshot has been taken yet, in which case the brain should be initialised
+//as normal before the journal is replayed into it.
+//
+//Brains implementing JSONDecoder are streamed straight from the snapshot file.
+func (journal *Journal) LoadSnapshot(brain json.Unmarshaler) (bool, error) {
+    journal.lock.Lock()
+    defer journal.lock.Unlock()
+
+    file, err := os.Open(journal.snapshotPath)
+    if os.IsNotExist(err) {
+        return false, nil
+    } else if err != nil {
+        return false, err
+    }
+    defer file.Close()
+
+    decoder := json.NewDecoder(bufio.NewReader(file))
+    err = DecodeObject(decoder, func(key string) error {
+        switch key {
+        case "Generation":
+            var generation int
+            err := decoder.Decode(&generation)
+            log.Info("Loading snapshot generation ", generation)
+            return err
+        case "Brain":
+            if streamer, ok := brain.(JSONDecoder); ok {
+                return streamer.DecodeJSON(decoder)
+            }
+            var b json.RawMessage
+            if err := decoder.Decode(&b); err != nil {
+                return err
+            }
+            return brain.UnmarshalJSON(b)
+        default:
+            return SkipValue(decoder)
+        }
+    })
+
+    return err == nil, err
+}
+
+//Replay calls apply for every entry written since the last snapshot, in the
+//order they were appended. A partially written entry at the end of the
+//journal is discarded.
+func (journal *Journal) Replay(apply func(JournalEntry) error) error {
+    journal.lock.Lock()
+    defer journal.lock.Unlock()
+
+    generation, err := snapshotGeneration(journal.snapshotPath)
+    if err != nil {
+        return err
+    }
+
+    if _, err := journal.file.Seek(0, io.SeekStart); err != nil {
+        return err
+    }
+    reader := bufio.NewReader(journal.file)
+
+    var header journalHeader
+    line, err := reader.ReadBytes('\n')
+    if err != nil || json.Unmarshal(line, &header) != nil {
+        //The header was never fully written, so there's nothing to replay
+        log.Warn("Journal header is incomplete, resetting journal")
+        return journal.reset(generation)
+    }
+    if header.Generation < generation {
+        //We crashed after the snapshot was written but before the journal
+        //was cleared, so everything in here is already in the snapshot
+        log.Warn("Journal predates snapshot, discarding it")
+        return journal.reset(generation)
+    }
+
+    offset := int64(len(line))
+    entries := 0
+    for {
+        line, err := reader.ReadBytes('\n')
+        if err == io.EOF {
+            if len(bytes.TrimSpace(line)) > 0 {
+                log.Warn("Discarding incomplete journal entry")
+            }
+            break
+        } else if err != nil {
+            return err
+        }
+
+        var entry JournalEntry
+        if err := json.Unmarshal(line, &entry); err != nil {
+            return fmt.Errorf("Corrupt journal entry at offset %d: %v", offset, err)
+        }
+        if err := apply(entry); err != nil {
+            return err
+        }
+        offset += int64(len(line))
+        entries++
+    }
+    log.Info("Replayed ", entries, " journal entries")
+
+    //Drop anything after the last complete entry so new entries aren't
+    //appended to a half-written line
+    if err := journal.file.Truncate(offset); err != nil {
+        return err
+    }
+    if _, err := journal.file.Seek(offset, io.SeekStart); err != nil {
+        return err
+    }
+    journal.generation = header.Generation
+    journal.pending = entries
+
+    return nil
+}
+
+//Append writes entry to the journal, and compacts the journal into a fresh
+//snapshot of brain once enough entries have built up
+func (journal *Journal) Append(entry JournalEntry, brain json.Marshaler) error {
+    b, err := json.Marshal(entry)
+    if err != nil {
+        return err
+    }
+
+    journal.lock.Lock()
+    if _, err := journal.file.Write(append(b, '\n')); err != nil {
+        journal.lock.Unlock()
+        return err
+    }
+    journal.pending++
+    due := journal.compactEvery > 0 && journal.pending >= journal.compactEvery
+    journal.lock.Unlock()
+
+    if due {
+        return journal.Compact(brain)
+    }
+    return nil
+}
+
+//Compact writes a full snapshot of brain and clears the journal. Only
+//training is journaled, so anything else that changes a brain, such as
+//merging or its settings, must be followed by a Compact to survive a crash.
+func (journal *Journal) Compact(brain json.Marshaler) error {
+    b, err := brain.MarshalJSON()
+    if err != nil {
+        return err
+    }
+
+    journal.lock.Lock()
+    defer journal.lock.Unlock()
+
+    generation := journal.generation + 1
+    snapshot, err := json.Marshal(snapshotJSON{generation, b})
+    if err != nil {
+        return err
+    }
+
+    //Write to a temporary file first so a crash can't leave us with half a
+    //snapshot
+    tmpPath := journal.snapshotPath + ".tmp"
+    tmp, err := os.Create(tmpPath)
+    if err != nil {
+        return err
+    }
+    if _, err := tmp.Write(snapshot); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Sync(); err != nil {
+        tmp.Close()
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        return err
+    }
+    if err := os.Rename(tmpPath, journal.snapshotPath); err != nil {
+        return err
+    }
+    log.Info("Saved snapshot generation ", generation)
+
+    return journal.reset(generation)
+}
+
+//Close closes the journal file. It does not take a snapshot.
+func (journal *Journal) Close() error {
+    journal.lock.Lock()
+    defer journal.lock.Unlock()
+    return journal.file.Close()
+}
+
+func (journal *Journal) reset(generation int) error {
+    if err := journal.file.Truncate(0); err != nil {
+        return err
+    }
+    if _, err := journal.file.Seek(0, io.SeekStart); err != nil {
+        return err
+    }
+
+    b, err := json.Marshal(journalHeader{generation})
+    if err != nil {
+        return err
+    }
+    if _, err := journal.file.Write(append(b, '\n')); err != nil {
+        return err
+    }
+
+    journal.generation = generation
+    journal.pending = 0
+    return journal.file.Sync()
+}
+
+//snapshotGeneration reads just the generation from the front of a snapshot,
+//without decoding the brain itself
+func snapshotGeneration(path string) (int, error) {
+    file, err := os.Open(path)
+    if os.IsNotExist(err) {
+        return 0, nil
+    } else if err != nil {
+        return 0, err
+    }
+    defer file.Close()
+
+    decoder := json.NewDecoder(file)
+    for {
+        token, err := decoder.Token()
+        if err != nil {
+            return 0, fmt.Errorf("Unable to read snapshot generation: %v", err)
+        }
+        if token == "Generation" {
+            var generation int
+            err := decoder.Decode(&generation)
+            return generation, err
+        }
+    }
+}
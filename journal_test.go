@@ -0,0 +1,149 @@
+package brain
+
+import (
+    "encoding/json"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+//fakeBrain just remembers everything it's trained on
+type fakeBrain struct {
+    Trained [][]string
+}
+
+func (brain fakeBrain) MarshalJSON() ([]byte, error) {
+    return json.Marshal(brain.Trained)
+}
+
+func (brain *fakeBrain) UnmarshalJSON(b []byte) error {
+    return json.Unmarshal(b, &brain.Trained)
+}
+
+func (brain *fakeBrain) apply(entry JournalEntry) error {
+    brain.Trained = append(brain.Trained, entry.Tokens)
+    return nil
+}
+
+func openJournal(t *testing.T, dir string, compactEvery int) *Journal {
+    journal, err := OpenJournal(filepath.Join(dir, "journal"), filepath.Join(dir, "snapshot"), compactEvery)
+    if err != nil {
+        t.Fatalf("FAIL, unable to open journal: %v", err)
+    }
+    return journal
+}
+
+//restore loads a fakeBrain the same way a real brain would be loaded at startup
+func restore(t *testing.T, journal *Journal) *fakeBrain {
+    brain := new(fakeBrain)
+    if _, err := journal.LoadSnapshot(brain); err != nil {
+        t.Fatalf("FAIL, unable to load snapshot: %v", err)
+    }
+    if err := journal.Replay(brain.apply); err != nil {
+        t.Fatalf("FAIL, unable to replay journal: %v", err)
+    }
+    return brain
+}
+
+func TestJournal(t *testing.T) {
+    tables := []struct {
+        testcase     string
+        compactEvery int
+        data         [][]string
+    }{
+        {"Nothing trained", 0, [][]string{}},
+        {"Never compacted", 0, [][]string{{"test"}, {"test", " ", "data"}}},
+        {"Compacted once", 2, [][]string{{"test"}, {"test", " ", "data"}, {"data"}}},
+        {"Compacted on last entry", 3, [][]string{{"test"}, {"test", " ", "data"}, {"data"}}},
+        {"Compacted every entry", 1, [][]string{{"test"}, {"test", " ", "data"}, {"data"}}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        dir := t.TempDir()
+
+        journal := openJournal(t, dir, table.compactEvery)
+        brain := restore(t, journal)
+        for _, tokens := range table.data {
+            brain.apply(JournalEntry{Tokens: tokens})
+            if err := journal.Append(JournalEntry{Tokens: tokens}, brain); err != nil {
+                t.Errorf("FAIL, unable to append to journal: %v", err)
+            }
+        }
+        //Simulate a crash by not taking a final snapshot
+        journal.Close()
+
+        journal = openJournal(t, dir, table.compactEvery)
+        got := restore(t, journal)
+        journal.Close()
+
+        if len(got.Trained) != len(table.data) || (len(table.data) > 0 && !reflect.DeepEqual(got.Trained, table.data)) {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.data, got.Trained)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestJournalIncompleteEntry(t *testing.T) {
+    dir := t.TempDir()
+    journal := openJournal(t, dir, 0)
+    brain := restore(t, journal)
+    journal.Append(JournalEntry{Tokens: []string{"test"}}, brain)
+    journal.Close()
+
+    //Simulate a crash part way through writing an entry
+    file, _ := os.OpenFile(filepath.Join(dir, "journal"), os.O_WRONLY|os.O_APPEND, 0644)
+    file.WriteString(`{"Tokens":["da`)
+    file.Close()
+
+    journal = openJournal(t, dir, 0)
+    brain = restore(t, journal)
+    journal.Append(JournalEntry{Tokens: []string{"data"}}, brain)
+    journal.Close()
+
+    journal = openJournal(t, dir, 0)
+    got := restore(t, journal)
+    journal.Close()
+
+    expected := [][]string{{"test"}, {"data"}}
+    if !reflect.DeepEqual(got.Trained, expected) {
+        t.Errorf("FAIL, expected: %#v, got: %#v", expected, got.Trained)
+    }
+}
+
+func TestJournalStaleAfterCompaction(t *testing.T) {
+    dir := t.TempDir()
+    journal := openJournal(t, dir, 0)
+    brain := restore(t, journal)
+    journal.Append(JournalEntry{Tokens: []string{"test"}}, brain)
+    brain.apply(JournalEntry{Tokens: []string{"test"}})
+    journal.Close()
+
+    //Simulate a crash after the snapshot was written but before the journal
+    //was cleared
+    stale, _ := ioutil.ReadFile(filepath.Join(dir, "journal"))
+    journal = openJournal(t, dir, 0)
+    if err := journal.Compact(brain); err != nil {
+        t.Fatalf("FAIL, unable to compact journal: %v", err)
+    }
+    journal.Close()
+    ioutil.WriteFile(filepath.Join(dir, "journal"), stale, 0644)
+
+    journal = openJournal(t, dir, 0)
+    got := restore(t, journal)
+    journal.Close()
+
+    expected := [][]string{{"test"}}
+    if !reflect.DeepEqual(got.Trained, expected) {
+        t.Errorf("FAIL, expected: %#v, got: %#v", expected, got.Trained)
+    }
+
+    snapshot, _ := ioutil.ReadFile(filepath.Join(dir, "snapshot"))
+    if !strings.HasPrefix(string(snapshot), `{"Generation":1,`) {
+        t.Errorf("FAIL, unexpected snapshot: %s", snapshot)
+    }
+}
@@ -0,0 +1,182 @@
+package brain
+
+import (
+    "regexp"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+var (
+    sentenceBoundary = regexp.MustCompile(`^[.!?…]+["')\]]*\s*$`)
+    clauseBoundary   = regexp.MustCompile(`^\s*[,;:–—-]+\s*$`)
+    dangling         = regexp.MustCompile(`^[\s,;:–—-]*$`)
+)
+
+//DefaultRetries is how many times a brain tries to make a reply long enough
+//when Limits doesn't say
+const DefaultRetries = 5
+
+//MinLengthStrategy is how a brain makes a reply reach the minimum length
+type MinLengthStrategy int
+
+const (
+    //Resample generates the whole reply again from the same subject, keeping
+    //the longest attempt
+    Resample MinLengthStrategy = iota
+    //SuppressEnd picks another token whenever the reply would end early
+    SuppressEnd
+)
+
+//Limits bounds the length of a reply in words and characters, rather than in
+//the tokens ProcessString splits it into, which include whitespace and
+//punctuation. Zero means no limit.
+type Limits struct {
+    MinWords int `json:",omitempty"`
+    MaxWords int `json:",omitempty"`
+    MaxChars int `json:",omitempty"`
+    //Strategy and Retries say how replies under MinWords are lengthened,
+    //and how many attempts to make before settling for a short reply
+    Strategy MinLengthStrategy `json:",omitempty"`
+    Retries  int               `json:",omitempty"`
+}
+
+//Bounded reports whether the limits set a maximum length
+func (limits Limits) Bounded() bool {
+    return limits.MaxWords > 0 || limits.MaxChars > 0
+}
+
+//Short reports whether tokens are under the minimum
+func (limits Limits) Short(tokens []string) bool {
+    return limits.MinWords > 0 && CountWords(tokens) < limits.MinWords
+}
+
+//RetryBudget is how many attempts can be made to lengthen a short reply
+func (limits Limits) RetryBudget() int {
+    if limits.Retries > 0 {
+        return limits.Retries
+    }
+    return DefaultRetries
+}
+
+//Exceeded reports whether tokens are over either maximum
+func (limits Limits) Exceeded(tokens []string) bool {
+    return (limits.MaxWords > 0 && CountWords(tokens) > limits.MaxWords) ||
+        (limits.MaxChars > 0 && countChars(tokens) > limits.MaxChars)
+}
+
+//TokenLimit is a generous number of tokens that's sure to be over the
+//limits, to stop generation that never gets any closer to them
+func (limits Limits) TokenLimit() int {
+    tokens := 0
+    if limits.MaxWords > 0 {
+        //Every word could be followed by punctuation and whitespace
+        tokens = 3*limits.MaxWords + 3
+    }
+    if limits.MaxChars > 0 && (tokens == 0 || limits.MaxChars+1 < tokens) {
+        //Every token has at least one character
+        tokens = limits.MaxChars + 1
+    }
+    return tokens
+}
+
+//Half splits the limits between the two halves of a reply
+func (limits Limits) Half() Limits {
+    return Limits{
+        MinWords: (limits.MinWords + 1) / 2,
+        MaxWords: (limits.MaxWords + 1) / 2,
+        MaxChars: (limits.MaxChars + 1) / 2,
+        Strategy: limits.Strategy,
+        Retries:  limits.Retries,
+    }
+}
+
+//Fit cuts tokens down to fit within the limits. Rather than stopping dead
+//at the limit, it goes back to the end of the last sentence, or failing that
+//the last clause, as long as that doesn't lose more than half the reply or
+//take it under the minimum. Failing both, it stops after the last whole word.
+//Replies that already fit only lose any dangling whitespace or commas.
+func (limits Limits) Fit(tokens []string) []string {
+    end := 0
+    for end < len(tokens) && !limits.Exceeded(tokens[:end+1]) {
+        end++
+    }
+    if end == len(tokens) {
+        return tidy(tokens)
+    }
+
+    prefix := tokens[:end]
+    least := CountWords(prefix) / 2
+    if limits.MinWords > least {
+        least = limits.MinWords
+    }
+
+    for i := len(prefix); i > 0; i-- {
+        if sentenceBoundary.MatchString(prefix[i-1]) && CountWords(prefix[:i]) >= least {
+            return trimLast(prefix[:i])
+        }
+    }
+    for i := len(prefix); i > 0; i-- {
+        if clauseBoundary.MatchString(prefix[i-1]) && CountWords(prefix[:i-1]) >= least {
+            return prefix[:i-1]
+        }
+    }
+    for i := len(prefix); i > 0; i-- {
+        if isWord(prefix[i-1]) {
+            return prefix[:i]
+        }
+    }
+    return prefix[:0]
+}
+
+//CountWords counts the words in a processed message. Contractions like
+//"don't", which ProcessString splits in three, count as one word.
+func CountWords(tokens []string) int {
+    words := 0
+    for i, token := range tokens {
+        if !isWord(token) {
+            continue
+        }
+        if i >= 2 && (tokens[i-1] == "'" || tokens[i-1] == "’") && isWord(tokens[i-2]) {
+            continue
+        }
+        words++
+    }
+    return words
+}
+
+func countChars(tokens []string) int {
+    chars := 0
+    for _, token := range tokens {
+        chars += utf8.RuneCountInString(token)
+    }
+    return chars
+}
+
+func isWord(token string) bool {
+    for _, r := range token {
+        if unicode.IsLetter(r) || unicode.IsDigit(r) {
+            return true
+        }
+    }
+    return false
+}
+
+//tidy takes any dangling whitespace or clause punctuation off the end
+func tidy(tokens []string) []string {
+    end := len(tokens)
+    for end > 0 && dangling.MatchString(tokens[end-1]) {
+        end--
+    }
+    if end == 0 {
+        return tokens[:0]
+    }
+    return trimLast(tokens[:end])
+}
+
+//trimLast takes any trailing whitespace off the last token
+func trimLast(tokens []string) []string {
+    trimmed := append([]string{}, tokens...)
+    trimmed[len(trimmed)-1] = strings.TrimRightFunc(trimmed[len(trimmed)-1], unicode.IsSpace)
+    return trimmed
+}
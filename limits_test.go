@@ -0,0 +1,99 @@
+package brain
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestCountWords(t *testing.T) {
+	tables := []struct {
+		testcase string
+		input    string
+		expected int
+	}{
+		{"Empty string", "", 0},
+		{"Words", "test data test", 3},
+		{"Punctuation", "test, data! test...", 3},
+		{"Contraction", "don't test", 2},
+		{"Numbers", "test 3.50 data", 4},
+	}
+
+	for _, table := range tables {
+		t.Logf("Testing: %s", table.testcase)
+		if got := CountWords(ProcessString(table.input)); got != table.expected {
+			t.Errorf("FAIL, expected: %d, got: %d", table.expected, got)
+		} else {
+			t.Log("Passed")
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	tables := []struct {
+		testcase string
+		limits   Limits
+		input    string
+		expected string
+	}{
+		{"No limits", Limits{}, "test data. data test", "test data. data test"},
+		{"Within limits", Limits{MaxWords: 4, MaxChars: 20}, "test data. data test", "test data. data test"},
+		{"Sentence boundary", Limits{MaxWords: 5}, "test data test. data test data", "test data test."},
+		{"Sentence boundary too early", Limits{MaxWords: 5}, "test. data test data test data", "test. data test data test"},
+		{"Sentence boundary under minimum", Limits{MinWords: 3, MaxWords: 5}, "test data. test data test data", "test data. test data test"},
+		{"Clause boundary", Limits{MaxWords: 5}, "test data test, data test data", "test data test"},
+		{"Word boundary", Limits{MaxWords: 3}, "test data test data", "test data test"},
+		{"Characters", Limits{MaxChars: 12}, "test data test data", "test data"},
+		{"Characters, sentence boundary", Limits{MaxChars: 18}, "test data! test data", "test data!"},
+		{"Dangling comma", Limits{MaxWords: 4}, "test data, ", "test data"},
+		{"Trailing space after full stop", Limits{MaxWords: 4}, "test data. ", "test data."},
+		{"Too short for anything", Limits{MaxChars: 2}, "test data", ""},
+	}
+
+	for _, table := range tables {
+		t.Logf("Testing: %s", table.testcase)
+		got := strings.Join(table.limits.Fit(ProcessString(table.input)), "")
+		if got != table.expected {
+			t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+		} else {
+			t.Log("Passed")
+		}
+	}
+}
+
+func TestLimitsHalf(t *testing.T) {
+    expected := Limits{MinWords: 2, MaxWords: 5, MaxChars: 80, Strategy: SuppressEnd, Retries: 3}
+    if got := (Limits{MinWords: 3, MaxWords: 10, MaxChars: 160, Strategy: SuppressEnd, Retries: 3}).Half(); !reflect.DeepEqual(got, expected) {
+        t.Errorf("FAIL, expected: %#v, got: %#v", expected, got)
+    }
+}
+
+func TestLimitsShort(t *testing.T) {
+    tables := []struct {
+        testcase string
+        limits   Limits
+        message  string
+        expected bool
+    }{
+        {"No minimum", Limits{}, "Hi", false},
+        {"Under", Limits{MinWords: 3}, "Hi there", true},
+        {"Exactly", Limits{MinWords: 3}, "Hi there, you", false},
+        {"Contraction", Limits{MinWords: 3}, "Don't go", true},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        if got := table.limits.Short(ProcessString(table.message)); got != table.expected {
+            t.Errorf("FAIL, expected: %v, got: %v", table.expected, got)
+        }
+    }
+}
+
+func TestLimitsRetryBudget(t *testing.T) {
+    if got := (Limits{}).RetryBudget(); got != DefaultRetries {
+        t.Errorf("FAIL, expected: %v, got: %v", DefaultRetries, got)
+    }
+    if got := (Limits{Retries: 12}).RetryBudget(); got != 12 {
+        t.Errorf("FAIL, expected: %v, got: %v", 12, got)
+    }
+}
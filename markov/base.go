@@ -0,0 +1,768 @@
+package markov
+
+import (
+    "encoding/json"
+    "fmt"
+	log "github.com/sirupsen/logrus"
+    "io"
+    "runtime"
+    "strings"
+    "time"
+    chatbrains "github.com/MattChubb/chatbrains"
+    "github.com/MattChubb/chatbrains/markovchain"
+)
+
+//Chains is the part of a brain that depends on how its Markov chains are
+//laid out, such as a single forward chain, or a forward and a backward chain.
+//Base does everything else.
+type Chains interface {
+    //Order is how many tokens of context the chains use
+    Order() int
+    //Forward is the chain that generates sentences from their start, along
+    //with what traces call it
+    Forward() (*markovchain.Chain, string)
+    //Add trains the chains on tokens, weight times over
+    Add(tokens []string, weight int)
+    //Contains reports whether the chains have every transition in tokens
+    Contains(tokens []string) bool
+    //Remove untrains tokens, leaving the chains unchanged if they don't
+    //contain them
+    Remove(tokens []string, weight int) error
+    //Scale multiplies every count by factor
+    Scale(factor float64)
+    //Prune removes transitions seen fewer than threshold times
+    Prune(threshold int)
+    //Empty returns chains laid out the same way, with nothing in them
+    Empty() Chains
+    //Merge adds other, laid out the same way, weight times over
+    Merge(other Chains, weight int) error
+    //Sentence generates a sentence around subject, of at most lengthLimit
+    //tokens, or within limits if they're bounded
+    Sentence(subject []string, lengthLimit int, limits chatbrains.Limits, trace *chatbrains.Trace) Draft
+}
+
+//Settings is everything saved with a brain besides its chains. Brains
+//built on Base embed it in their saved JSON.
+type Settings struct {
+    LengthLimit    int
+    Decay          *chatbrains.Decay        `json:",omitempty"`
+    Provenance     *chatbrains.Provenance   `json:",omitempty"`
+    SplitSentences bool                     `json:",omitempty"`
+    MaxSentences   int                      `json:",omitempty"`
+    Limits         *chatbrains.Limits       `json:",omitempty"`
+    Novelty        *chatbrains.NoveltyGuard `json:",omitempty"`
+    Redactor       *chatbrains.Redactor     `json:",omitempty"`
+}
+
+//DecodeSetting decodes the next value in decoder into the field of settings
+//named key, skipping it if there's no such field
+func DecodeSetting(decoder *json.Decoder, key string, settings *Settings) error {
+    switch key {
+    case "LengthLimit":
+        return decoder.Decode(&settings.LengthLimit)
+    case "Decay":
+        return decoder.Decode(&settings.Decay)
+    case "Provenance":
+        return decoder.Decode(&settings.Provenance)
+    case "SplitSentences":
+        return decoder.Decode(&settings.SplitSentences)
+    case "MaxSentences":
+        return decoder.Decode(&settings.MaxSentences)
+    case "Limits":
+        return decoder.Decode(&settings.Limits)
+    case "Novelty":
+        return decoder.Decode(&settings.Novelty)
+    case "Redactor":
+        return decoder.Decode(&settings.Redactor)
+    default:
+        return chatbrains.SkipValue(decoder)
+    }
+}
+
+//Base is everything a Markov brain does that doesn't depend on how its
+//chains are laid out: training, journaling, decay, provenance and putting
+//replies together. Brains embed it, giving it their chains.
+type Base struct {
+    //brain is the brain embedding Base, which is what gets journaled
+    brain          json.Marshaler
+    chains         Chains
+    lengthLimit    int
+    journal        *chatbrains.Journal
+    decay          *chatbrains.Decay
+    provenance     *chatbrains.Provenance
+    memory         *chatbrains.Memory
+    splitSentences bool
+    maxSentences   int
+    limits         chatbrains.Limits
+    novelty        *chatbrains.NoveltyGuard
+    redactor       *chatbrains.Redactor
+}
+
+//NewBase builds the Base for brain, with its chains and saved settings
+func NewBase(brain json.Marshaler, chains Chains, settings Settings) Base {
+    base := Base{
+        brain:          brain,
+        chains:         chains,
+        lengthLimit:    settings.LengthLimit,
+        decay:          settings.Decay,
+        provenance:     settings.Provenance,
+        splitSentences: settings.SplitSentences,
+        maxSentences:   settings.MaxSentences,
+        novelty:        settings.Novelty,
+        redactor:       settings.Redactor,
+    }
+    if settings.Limits != nil {
+        base.limits = *settings.Limits
+    }
+    return base
+}
+
+//Settings returns what should be saved with the brain besides its chains
+func (base *Base) Settings() Settings {
+    var limits *chatbrains.Limits
+    if base.limits != (chatbrains.Limits{}) {
+        limits = &base.limits
+    }
+
+    return Settings{
+        base.lengthLimit,
+        base.decay,
+        base.provenance,
+        base.splitSentences,
+        base.maxSentences,
+        limits,
+        base.novelty,
+        base.redactor,
+    }
+}
+
+//UseJournal replays anything in journal that isn't in the brain's snapshot
+//yet, then records all further training to it
+func (base *Base) UseJournal(journal *chatbrains.Journal) error {
+    err := journal.Replay(func(entry chatbrains.JournalEntry) error {
+        base.apply(entry)
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+
+    base.journal = journal
+    return nil
+}
+
+func (base *Base) Train(data string) error {
+    log.Debug("Braindump: ", base.brain)
+    _, err := base.train(data, nil)
+    return err
+}
+
+//TrainWithMeta trains the brain like Train, also recording who the message
+//came from so that it can be erased again with EraseAuthor
+func (base *Base) TrainWithMeta(data string, meta chatbrains.Meta) error {
+    _, err := base.TrainMessage(data, &meta)
+    return err
+}
+
+//TrainMessage trains the brain like TrainWithMeta, or like Train if meta is
+//nil, returning how many tokens were trained
+func (base *Base) TrainMessage(data string, meta *chatbrains.Meta) (int, error) {
+    if meta != nil && meta.Time.IsZero() {
+        timed := *meta
+        timed.Time = time.Now()
+        meta = &timed
+    }
+    return base.train(data, meta)
+}
+
+//TrainFrom trains the brain on every message in a corpus, calling progress
+//(if it's not nil) as it goes
+func (base *Base) TrainFrom(r io.Reader, format chatbrains.Format, progress func(chatbrains.TrainStats)) (chatbrains.TrainStats, error) {
+    return chatbrains.TrainCorpus(r, format, progress, base.train)
+}
+
+//TrainParallel trains the brain on every message in a corpus like TrainFrom,
+//but splits the work across workers goroutines (or one per CPU if workers
+//is 0), each building its own partial chains to be merged in at the end. If
+//the brain has a journal, a snapshot is taken once training is done rather
+//than journaling every message.
+func (base *Base) TrainParallel(r io.Reader, format chatbrains.Format, workers int, progress func(chatbrains.TrainStats)) (chatbrains.TrainStats, error) {
+    if workers <= 0 {
+        workers = runtime.NumCPU()
+    }
+    if err := base.Decay(time.Now()); err != nil {
+        return chatbrains.TrainStats{}, err
+    }
+
+    weight := base.weight()
+    shards := make([]Chains, workers)
+    provenances := make([]*chatbrains.Provenance, workers)
+    for i := range shards {
+        shards[i] = base.chains.Empty()
+    }
+
+    read := func(fn func(chatbrains.Message) error) error {
+        return chatbrains.ReadCorpus(r, format, fn)
+    }
+    stats, err := chatbrains.TrainParallel(read, workers, progress, func(worker int, data string, meta *chatbrains.Meta) int {
+        tokens := 0
+        for _, processedData := range base.sequences(data) {
+            shards[worker].Add(processedData, weight)
+            if meta != nil && meta.AuthorID != "" {
+                if provenances[worker] == nil {
+                    provenances[worker] = chatbrains.NewProvenance()
+                }
+                provenances[worker].Add(processedData, *meta)
+            }
+            if base.novelty != nil {
+                base.novelty.Add(processedData)
+            }
+            tokens += len(processedData)
+        }
+        return tokens
+    })
+
+    //Keep whatever was trained before any error, as TrainFrom would
+    log.Info("Merging ", workers, " partial chains")
+    for i, shard := range shards {
+        if mergeErr := base.chains.Merge(shard, 1); mergeErr != nil {
+            return stats, mergeErr
+        }
+        if provenances[i] != nil {
+            if base.provenance == nil {
+                base.provenance = chatbrains.NewProvenance()
+            }
+            base.provenance.Merge(provenances[i])
+        }
+    }
+
+    if base.journal != nil {
+        if compactErr := base.journal.Compact(base.brain); compactErr != nil && err == nil {
+            err = compactErr
+        }
+    }
+    return stats, err
+}
+
+//train adds data to the brain, returning how many tokens it was processed into
+func (base *Base) train(data string, meta *chatbrains.Meta) (int, error) {
+    log.Debug("Training data: ", data)
+    sequences := base.sequences(data)
+    log.Debug("Processed into: ", sequences)
+
+    if err := base.Decay(time.Now()); err != nil {
+        return 0, err
+    }
+    tokens := 0
+    for _, processedData := range sequences {
+        entry := chatbrains.JournalEntry{Tokens: processedData, Weight: base.weight(), Meta: meta}
+        if err := base.record(entry); err != nil {
+            return tokens, err
+        }
+        tokens += len(processedData)
+    }
+    return tokens, nil
+}
+
+//sequences processes data into the token sequences it should be trained as:
+//one per sentence if sentence splitting is on, or one for the whole message,
+//with any personal information redacted
+func (base *Base) sequences(data string) [][]string {
+    if base.redactor != nil {
+        data = base.redactor.Redact(data)
+    }
+    if !base.splitSentences {
+        return [][]string{base.process(data)}
+    }
+    sentences := chatbrains.SplitSentences(data)
+    if len(sentences) == 0 {
+        //Train on empty messages just as we would without splitting
+        sentences = []string{data}
+    }
+    sequences := make([][]string, len(sentences))
+    for i, sentence := range sentences {
+        sequences[i] = base.process(sentence)
+    }
+    return sequences
+}
+
+//Process splits text into tokens as the brain would when training on it,
+//with anything the brain redacts replaced by placeholders
+func (base *Base) Process(text string) []string {
+    if base.redactor != nil {
+        text = base.redactor.Redact(text)
+    }
+    return base.process(text)
+}
+
+//process splits text into tokens, keeping placeholders whole if the brain
+//redacts them
+func (base *Base) process(text string) []string {
+    if base.redactor != nil {
+        return chatbrains.ProcessRedacted(text)
+    }
+    return chatbrains.ProcessString(text)
+}
+
+//Untrain removes the contribution a previous call to Train made with the
+//same data, for when a message has to be forgotten. Only the brain's
+//transitions are checked, as messages trained without an author leave no
+//other record: untraining a message that was never trained, but whose every
+//transition was, such as "test data" after "test data test data", takes its
+//counts from the messages that were. Prefer EraseAuthor where possible.
+func (base *Base) Untrain(data string) error {
+    log.Debug("Untraining data: ", data)
+    sequences := base.sequences(data)
+    log.Debug("Processed into: ", sequences)
+
+    if err := base.Decay(time.Now()); err != nil {
+        return err
+    }
+    for _, processedData := range sequences {
+        if !base.chains.Contains(processedData) {
+            return fmt.Errorf("Brain was never trained on %q", data)
+        }
+    }
+    for _, processedData := range sequences {
+        entry := chatbrains.JournalEntry{Tokens: processedData, Weight: base.weight(), Untrain: true}
+        if err := base.record(entry); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+//EraseAuthor untrains every message recorded as coming from the given
+//author, returning how many there were
+func (base *Base) EraseAuthor(id string) (int, error) {
+    if base.provenance == nil {
+        return 0, nil
+    }
+
+    records := base.provenance.Records(id)
+    log.Info("Erasing ", len(records), " messages from ", id)
+    for i, record := range records {
+        entry := chatbrains.JournalEntry{
+            Tokens:  record.Tokens,
+            Weight:  base.weight(),
+            Meta:    &chatbrains.Meta{AuthorID: id, ChatID: record.ChatID, Time: record.Time},
+            Untrain: true,
+        }
+        if err := base.record(entry); err != nil {
+            return i, err
+        }
+    }
+    return len(records), nil
+}
+
+//MergeWeighted adds everything other has been trained on to the brain, with
+//the brain's existing counts multiplied by weight and other's by
+//otherWeight, so one source can count for more than the other. Both must
+//have chains of the same order and layout. Authors recorded in other can be
+//erased from the merged brain, though only one unit of weight is untrained
+//per message.
+func (base *Base) MergeWeighted(other *Base, weight int, otherWeight int) error {
+    if base.chains.Order() != other.chains.Order() {
+        return fmt.Errorf("Unable to merge a brain of order %d into one of order %d", other.chains.Order(), base.chains.Order())
+    }
+    if other == base {
+        return fmt.Errorf("Unable to merge a brain into itself")
+    }
+    if weight < 1 || otherWeight < 1 {
+        return fmt.Errorf("Merge weights must be positive, got %d and %d", weight, otherWeight)
+    }
+    //Counts in brains with decay enabled are in different units
+    if other.decay != nil && base.decay == nil {
+        return fmt.Errorf("Unable to merge a brain with decay enabled into one without")
+    }
+    otherWeight *= base.weight() / other.weight()
+
+    if weight != 1 {
+        base.chains.Scale(float64(weight))
+    }
+    if err := base.chains.Merge(other.chains, otherWeight); err != nil {
+        return err
+    }
+    if other.provenance != nil {
+        if base.provenance == nil {
+            base.provenance = chatbrains.NewProvenance()
+        }
+        base.provenance.Merge(other.provenance)
+    }
+    if other.novelty != nil && base.novelty != nil {
+        base.novelty.Merge(other.novelty)
+    }
+    log.Debug("Braindump: ", base.brain)
+
+    if base.journal != nil {
+        return base.journal.Compact(base.brain)
+    }
+    return nil
+}
+
+//SetSentenceSplitting sets whether each sentence of a message is trained as
+//a sequence of its own, so that the brain learns how every sentence starts
+//and ends rather than just the first and last. It's saved with the brain.
+func (base *Base) SetSentenceSplitting(split bool) {
+    base.splitSentences = split
+}
+
+//SetMaxSentences sets how many sentences a reply can have, as long as they
+//fit in the length limit. It's saved with the brain.
+func (base *Base) SetMaxSentences(max int) {
+    base.maxSentences = max
+}
+
+//SetLimits bounds replies in words and characters. When a maximum is set,
+//replies end at a natural boundary within it, and the token length limit
+//from Init no longer applies. Replies under the minimum are lengthened with
+//the limits' Strategy. It's saved with the brain.
+func (base *Base) SetLimits(limits chatbrains.Limits) {
+    base.limits = limits
+}
+
+//SetRedactor makes the brain replace personal information in everything it's
+//trained on with placeholders, so that it can never repeat it. Messages
+//already trained aren't affected. It's saved with the brain, and a nil
+//redactor turns redaction off again.
+func (base *Base) SetRedactor(redactor *chatbrains.Redactor) {
+    base.redactor = redactor
+}
+
+//SetNoveltyGuard makes the brain check its replies against guard, generating
+//another reply whenever one repeats too much of a training message. Only
+//messages trained from now on are indexed. It's saved with the brain, and a
+//nil guard turns the check off again.
+func (base *Base) SetNoveltyGuard(guard *chatbrains.NoveltyGuard) error {
+    base.novelty = guard
+
+    if base.journal != nil {
+        return base.journal.Compact(base.brain)
+    }
+    return nil
+}
+
+//EnableDecay makes older training data gradually less likely than newer
+//data, halving its weight every halfLife
+func (base *Base) EnableDecay(halfLife time.Duration) error {
+    if base.decay == nil {
+        //Existing counts need to be in the same units as new ones
+        base.chains.Scale(chatbrains.DecayResolution)
+        base.decay = &chatbrains.Decay{Last: time.Now()}
+    }
+    base.decay.HalfLife = halfLife
+    log.Debug("Braindump: ", base.brain)
+
+    if base.journal != nil {
+        return base.journal.Compact(base.brain)
+    }
+    return nil
+}
+
+//Decay scales down the brain's counts to account for the time passed since
+//they were last decayed. It's called by Train, but can be called on a timer
+//too for brains that are rarely trained.
+func (base *Base) Decay(now time.Time) error {
+    if base.decay == nil {
+        return nil
+    }
+
+    step, due := base.decay.Step(now)
+    if !due {
+        return nil
+    }
+    log.Debug("Decaying counts by ", step.Factor)
+    return base.record(chatbrains.JournalEntry{Decay: &step})
+}
+
+//Prune removes transitions seen fewer than threshold times, to bound the
+//size of the brain
+func (base *Base) Prune(threshold int) error {
+    return base.record(chatbrains.JournalEntry{Prune: threshold * base.weight()})
+}
+
+//record applies entry to the brain, and writes it to the journal if there is one
+func (base *Base) record(entry chatbrains.JournalEntry) error {
+    base.apply(entry)
+    if base.journal != nil {
+        return base.journal.Append(entry, base.brain)
+    }
+    return nil
+}
+
+func (base *Base) apply(entry chatbrains.JournalEntry) {
+    weight := entry.Weight
+    if weight == 0 {
+        weight = 1
+    }
+
+    switch {
+    case entry.Decay != nil:
+        base.chains.Scale(entry.Decay.Factor)
+        if base.decay != nil {
+            base.decay.Last = entry.Decay.Time
+        }
+    case entry.Untrain:
+        //Counts may already have decayed or been pruned away, but the
+        //provenance record should go regardless
+        if err := base.chains.Remove(entry.Tokens, weight); err != nil {
+            log.Debug("Unable to untrain: ", err)
+        }
+        if base.provenance != nil {
+            authorID := ""
+            if entry.Meta != nil {
+                authorID = entry.Meta.AuthorID
+            }
+            base.provenance.Forget(entry.Tokens, authorID)
+        }
+        if base.novelty != nil {
+            base.novelty.Remove(entry.Tokens)
+        }
+    case entry.Prune > 0:
+        base.chains.Prune(entry.Prune)
+    default:
+        base.chains.Add(entry.Tokens, weight)
+        if entry.Meta != nil && entry.Meta.AuthorID != "" {
+            if base.provenance == nil {
+                base.provenance = chatbrains.NewProvenance()
+            }
+            base.provenance.Add(entry.Tokens, *entry.Meta)
+        }
+        if base.novelty != nil {
+            base.novelty.Add(entry.Tokens)
+        }
+    }
+}
+
+//weight is how much a single message counts for
+func (base *Base) weight() int {
+    if base.decay != nil {
+        return chatbrains.DecayResolution
+    }
+    return 1
+}
+
+//Order is how many tokens of context the brain uses to pick the next one
+func (base *Base) Order() int {
+    return base.chains.Order()
+}
+
+//Successors returns how many times each token has followed the last Order
+//tokens of context. Shorter contexts are padded with start tokens.
+func (base *Base) Successors(context []string) map[string]int {
+    chain, _ := base.chains.Forward()
+    successors, _ := chain.Successors(padContext(context, chain.Order))
+    return successors
+}
+
+//Vocabulary returns every token the brain can generate
+func (base *Base) Vocabulary() []string {
+    chain, _ := base.chains.Forward()
+    return chain.Tokens()
+}
+
+//SetMemory gives the brain a short-term memory of each conversation, which
+//GenerateFor uses to keep replies on topic. The memory can be shared
+//between brains.
+func (base *Base) SetMemory(memory *chatbrains.Memory) {
+    base.memory = memory
+}
+
+//GenerateFor generates a reply to prompt in the conversation chatID. If the
+//brain has a memory, the conversation so far guides the reply's subject, and
+//the prompt and reply are remembered for next time.
+func (base *Base) GenerateFor(chatID string, prompt string) (string, error) {
+    if base.memory == nil {
+        return base.Generate(prompt)
+    }
+
+    log.Debug("Input: ", prompt)
+    processedPrompt := base.process(prompt)
+    context := base.memory.Context(chatID)
+    log.Debug("Processed into: ", processedPrompt, " with context: ", context)
+
+    subject := chatbrains.ExtractSubjectWithContext(processedPrompt, context, base.chains.Order())
+    reply, err := base.GenerateFromSubject(subject)
+    base.memory.Remember(chatID, prompt)
+    if err == nil {
+        base.memory.Remember(chatID, reply)
+    }
+    return reply, err
+}
+
+//Generate generates a reply to prompt. If the brain redacts, placeholders
+//in the reply are filled with DefaultSlots.
+func (base *Base) Generate(prompt string) (string, error) {
+    reply, err := base.generateDetailed(prompt, base.slots(), nil)
+    return reply.Text, err
+}
+
+//GenerateWithSlots is Generate, but with placeholders like <user> in the
+//reply filled by filler, falling back to DefaultSlots, whether or not the
+//brain redacts
+func (base *Base) GenerateWithSlots(prompt string, filler chatbrains.SlotFiller) (string, error) {
+    if filler == nil {
+        filler = chatbrains.DefaultSlots
+    }
+    reply, err := base.generateDetailed(prompt, filler, nil)
+    return reply.Text, err
+}
+
+//GenerateDetailed is Generate, but also says how the reply was generated:
+//its subject and tokens, how likely each token was, why generation stopped,
+//and how long it took
+func (base *Base) GenerateDetailed(prompt string) (chatbrains.Reply, error) {
+    return base.generateDetailed(prompt, base.slots(), nil)
+}
+
+//Explain is GenerateDetailed, but also traces every step of generation, for
+//working out why a reply came out the way it did
+func (base *Base) Explain(prompt string) (chatbrains.Reply, error) {
+    return base.generateDetailed(prompt, base.slots(), new(chatbrains.Trace))
+}
+
+func (base *Base) generateDetailed(prompt string, filler chatbrains.SlotFiller, trace *chatbrains.Trace) (chatbrains.Reply, error) {
+    started := time.Now()
+    log.Debug("Input: ", prompt)
+    processedPrompt := base.process(prompt)
+    log.Debug("Processed into: ", processedPrompt)
+
+	subject := []string{}
+	if len(processedPrompt) > 0 {
+		subject = chatbrains.ExtractSubject(processedPrompt, base.chains.Order())
+	}
+	//TODO Any other clever Markov hacks?
+    reply, err := base.generate(subject, trace)
+    return chatbrains.Reply{
+        Text:          fill(reply.Tokens, filler),
+        Tokens:        reply.Tokens,
+        Subject:       subject,
+        Probabilities: reply.Probabilities,
+        StopReason:    reply.Stop,
+        Duration:      time.Since(started),
+        Trace:         trace,
+    }, err
+}
+
+//GenerateFromSubject generates a reply around subject, for callers that have
+//their own idea of what a reply should be about. Placeholders are filled as
+//they are by Generate.
+func (base *Base) GenerateFromSubject(subject []string) (string, error) {
+    reply, err := base.generate(subject, nil)
+    return fill(reply.Tokens, base.slots()), err
+}
+
+//slots is what fills placeholders in replies from Generate. Only brains that
+//redact fill them, so that other brains repeat any placeholders they were
+//trained on as they are.
+func (base *Base) slots() chatbrains.SlotFiller {
+    if base.redactor == nil {
+        return nil
+    }
+    return chatbrains.DefaultSlots
+}
+
+//fill joins a reply's tokens, filling its placeholders with filler if it's
+//not nil
+func fill(tokens []string, filler chatbrains.SlotFiller) string {
+    reply := strings.Join(tokens, "")
+    if filler == nil {
+        return reply
+    }
+    return chatbrains.FillSlots(reply, filler)
+}
+
+//Draft is a reply being generated, along with the probability of each of
+//its tokens and why generation stopped
+type Draft struct {
+    Tokens        []string
+    Probabilities []float64
+    Stop          chatbrains.StopReason
+}
+
+//generate generates a reply around subject, leaving placeholders unfilled.
+//It returns ErrNotNovel if every attempt repeats a training message.
+func (base *Base) generate(subject []string, trace *chatbrains.Trace) (Draft, error) {
+    reply := base.compose(subject, trace)
+    if base.novelty == nil {
+        return reply, nil
+    }
+    for retries := base.novelty.Retries(); !base.novelty.Novel(base.process(strings.Join(reply.Tokens, ""))); retries-- {
+        if retries <= 0 {
+            log.Debug("Unable to generate a novel reply")
+            return Draft{Stop: chatbrains.StopNotNovel}, chatbrains.ErrNotNovel
+        }
+        log.Debug("Reply repeats a training message, resampling: ", reply.Tokens)
+        trace.Note("Reply repeats a training message, resampling: %q", strings.Join(reply.Tokens, ""))
+        reply = base.compose(subject, trace)
+    }
+    return reply, nil
+}
+
+//compose generates a reply around subject, of the right length
+func (base *Base) compose(subject []string, trace *chatbrains.Trace) Draft {
+	sentence := base.generateFitted(subject, trace)
+    if base.limits.Strategy == chatbrains.Resample {
+        //Try again if it's too short, but settle for the longest attempt
+        for retries := base.limits.RetryBudget(); retries > 0 && base.limits.Short(sentence.Tokens); retries-- {
+            log.Debug("Reply too short, resampling: ", sentence.Tokens)
+            trace.Note("Reply too short, resampling: %q", strings.Join(sentence.Tokens, ""))
+            if candidate := base.generateFitted(subject, trace); len(candidate.Tokens) > len(sentence.Tokens) {
+                sentence = candidate
+            }
+        }
+    }
+    if len(sentence.Tokens) == 0 {
+        return sentence
+    }
+    sentence.Tokens[0] = strings.Title(sentence.Tokens[0])
+    return base.followOn(sentence, trace)
+}
+
+//generateFitted generates a sentence around subject, cut to fit the limits
+func (base *Base) generateFitted(subject []string, trace *chatbrains.Trace) Draft {
+	sentence := base.chains.Sentence(subject, base.lengthLimit, base.limits, trace)
+    if base.limits.Bounded() {
+        if base.limits.Exceeded(sentence.Tokens) {
+            sentence.Stop = chatbrains.StopLength
+            trace.Note("Too long, cutting to fit the limits: %q", strings.Join(sentence.Tokens, ""))
+        }
+        sentence.Tokens = base.limits.Fit(sentence.Tokens)
+        sentence.Probabilities = sentence.Probabilities[:len(sentence.Tokens)]
+    }
+    return sentence
+}
+
+//followOn adds more sentences to a reply while there's room for them,
+//generated forwards from the start of a sentence
+func (base *Base) followOn(sentence Draft, trace *chatbrains.Trace) Draft {
+    chain, name := base.chains.Forward()
+    for i := 1; i < base.maxSentences; i++ {
+        //Leave room for at least one token after the start tokens
+        remaining := base.lengthLimit - len(sentence.Tokens) - 1
+        if !base.limits.Bounded() && remaining < chain.Order+2 {
+            sentence.Stop = chatbrains.StopLength
+            break
+        }
+        //The reply's already long enough
+        limits := base.limits
+        limits.MinWords = 0
+        next := GenerateSentence(chain, name, []string{}, remaining, limits, trace)
+        if len(next.Tokens) == 0 {
+            break
+        }
+        next.Tokens[0] = strings.Title(next.Tokens[0])
+
+        //Only whole sentences are added
+        candidate := append(append(append([]string{}, sentence.Tokens...), " "), next.Tokens...)
+        if base.limits.Exceeded(candidate) {
+            trace.Note("Sentence doesn't fit, leaving it out: %q", strings.Join(next.Tokens, ""))
+            sentence.Stop = chatbrains.StopLength
+            break
+        }
+        sentence.Tokens = candidate
+        sentence.Probabilities = append(append(sentence.Probabilities, 1), next.Probabilities...)
+        sentence.Stop = next.Stop
+    }
+    return sentence
+}
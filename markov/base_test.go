@@ -0,0 +1,826 @@
+package markov
+
+import (
+    "bytes"
+    "fmt"
+    "math"
+	"testing"
+	"reflect"
+    "regexp"
+    "github.com/MattChubb/chatbrains/markovchain"
+    "path/filepath"
+    "strings"
+    "time"
+    chatbrains "github.com/MattChubb/chatbrains"
+)
+
+func TestUseJournal(t *testing.T) {
+    tables := []struct {
+        testcase     string
+        compactEvery int
+        data         []string
+    }{
+        {"Never compacted", 0, []string{"test data", "data test data"}},
+        {"Compacted", 2, []string{"test data", "data test data", "test"}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        dir := t.TempDir()
+        journalPath := filepath.Join(dir, "journal")
+        snapshotPath := filepath.Join(dir, "snapshot")
+
+        expected := new(Brain)
+        expected.Init(2, 32)
+        journal, _ := chatbrains.OpenJournal(journalPath, snapshotPath, table.compactEvery)
+        brain := new(Brain)
+        brain.Init(2, 32)
+        if err := brain.UseJournal(journal); err != nil {
+            t.Fatalf("FAIL, unable to use journal: %v", err)
+        }
+        for _, data := range table.data {
+            brain.Train(data)
+            expected.Train(data)
+        }
+        //Simulate a crash by not taking a final snapshot
+        journal.Close()
+
+        journal, _ = chatbrains.OpenJournal(journalPath, snapshotPath, table.compactEvery)
+        got := new(Brain)
+        if loaded, err := journal.LoadSnapshot(got); err != nil {
+            t.Fatalf("FAIL, unable to load snapshot: %v", err)
+        } else if !loaded {
+            got.Init(2, 32)
+        }
+        if err := got.UseJournal(journal); err != nil {
+            t.Fatalf("FAIL, unable to replay journal: %v", err)
+        }
+        journal.Close()
+
+        gotJSON, _ := got.MarshalJSON()
+        expectedJSON, _ := expected.MarshalJSON()
+        if string(gotJSON) != string(expectedJSON) {
+            t.Errorf("FAIL, expected: %s, got: %s", expectedJSON, gotJSON)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestDecay(t *testing.T) {
+    brain := new(Brain)
+    brain.Init(1, 32)
+    brain.Train("old")
+    if err := brain.EnableDecay(time.Hour); err != nil {
+        t.Fatalf("FAIL, unable to enable decay: %v", err)
+    }
+    brain.Train("old")
+    brain.Train("old")
+
+    //Two half-lives later, old messages count for a quarter as much
+    brain.Decay(brain.decay.Last.Add(2 * time.Hour))
+    brain.Train("new")
+
+    oldP, _ := brain.chain.TransitionProbability("old", markovchain.NGram{markovchain.StartToken})
+    newP, _ := brain.chain.TransitionProbability("new", markovchain.NGram{markovchain.StartToken})
+    if math.Abs(oldP-0.75/1.75) > 1e-3 || math.Abs(newP-1/1.75) > 1e-3 {
+        t.Errorf("FAIL, expected old: %.3f, new: %.3f, got old: %.3f, new: %.3f", 0.75/1.75, 1/1.75, oldP, newP)
+    } else {
+        t.Log("Passed")
+    }
+
+    //Decay settings should survive a save and load
+    saved, _ := brain.MarshalJSON()
+    loaded := new(Brain)
+    loaded.UnmarshalJSON(saved)
+    if loaded.decay == nil || loaded.decay.HalfLife != time.Hour {
+        t.Errorf("FAIL, decay settings lost, got: %#v", loaded.decay)
+    }
+}
+
+func TestPrune(t *testing.T) {
+    tables := []struct {
+        testcase  string
+        decay     bool
+        threshold int
+        expected  []string
+    }{
+        {"Nothing pruned", false, 1, []string{"common", "rare"}},
+        {"Rare word pruned", false, 2, []string{"common"}},
+        {"Everything pruned", false, 3, []string{}},
+        {"Rare word pruned, with decay", true, 2, []string{"common"}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(1, 32)
+        if table.decay {
+            brain.EnableDecay(time.Hour)
+        }
+        brain.Train("common")
+        brain.Train("common")
+        brain.Train("rare")
+
+        if err := brain.Prune(table.threshold); err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        }
+        got := []string{}
+        for _, word := range []string{"common", "rare"} {
+            if p, _ := brain.chain.TransitionProbability(word, markovchain.NGram{markovchain.StartToken}); p > 0 {
+                got = append(got, word)
+            }
+        }
+        if !reflect.DeepEqual(got, table.expected) {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestUntrain(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+        input    string
+        decay    bool
+    }{
+        {"New words, order 1", 1, "my password is hunter2", false},
+        {"New words, order 2", 2, "my password is hunter2", false},
+        {"Known words", 1, "data test", false},
+        {"Repeated message", 2, "test data test data", false},
+        {"With decay", 2, "my password is hunter2", true},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := newBrain(table.order, 32)
+        if table.decay {
+            brain.EnableDecay(time.Hour)
+        }
+        expected, _ := brain.MarshalJSON()
+
+        brain.Train(table.input)
+        if err := brain.Untrain(table.input); err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        }
+
+        got, _ := brain.MarshalJSON()
+        if string(got) != string(expected) {
+            t.Errorf("FAIL, expected: %s, got: %s", expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+
+    brain := newBrain(1, 32)
+    expected, _ := brain.MarshalJSON()
+    if err := brain.Untrain("never seen this"); err == nil {
+        t.Errorf("FAIL, expected an error untraining an unknown message")
+    }
+    if got, _ := brain.MarshalJSON(); string(got) != string(expected) {
+        t.Errorf("FAIL, failed untrain changed brain to: %s", got)
+    }
+}
+
+func TestUntrainProvenance(t *testing.T) {
+    when := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+    brain := new(Brain)
+    brain.Init(2, 32)
+    brain.TrainWithMeta("test data", chatbrains.Meta{AuthorID: "bob", Time: when})
+    brain.TrainWithMeta("test data", chatbrains.Meta{AuthorID: "alice", Time: when.Add(time.Hour)})
+
+    //The most recent message's record goes, so that it isn't untrained twice
+    if err := brain.Untrain("test data"); err != nil {
+        t.Fatalf("FAIL, unexpected error: %v", err)
+    }
+    if erased, _ := brain.EraseAuthor("alice"); erased != 0 {
+        t.Errorf("FAIL, expected alice's record to be forgotten, erased %d", erased)
+    } else if erased, _ := brain.EraseAuthor("bob"); erased != 1 {
+        t.Errorf("FAIL, expected bob's record to be kept, erased %d", erased)
+    } else if len(brain.Vocabulary()) != 0 {
+        t.Errorf("FAIL, expected an empty brain, got: %#v", brain.Vocabulary())
+    } else {
+        t.Log("Passed")
+    }
+}
+
+func TestEraseAuthor(t *testing.T) {
+    when := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+    bob := chatbrains.Meta{AuthorID: "bob", ChatID: "chat", Time: when}
+    alice := chatbrains.Meta{AuthorID: "alice", ChatID: "chat", Time: when}
+
+    expected := new(Brain)
+    expected.Init(2, 32)
+    expected.TrainWithMeta("test data", bob)
+    expected.TrainWithMeta("data test data", bob)
+
+    brain := new(Brain)
+    brain.Init(2, 32)
+    brain.TrainWithMeta("test data", bob)
+    brain.TrainWithMeta("my secret data", alice)
+    brain.TrainWithMeta("data test data", bob)
+    brain.TrainWithMeta("test secret", alice)
+
+    //The index of who said what should survive a save and load
+    saved, _ := brain.MarshalJSON()
+    brain = new(Brain)
+    brain.UnmarshalJSON(saved)
+
+    if erased, err := brain.EraseAuthor("alice"); err != nil {
+        t.Errorf("FAIL, unexpected error: %v", err)
+    } else if erased != 2 {
+        t.Errorf("FAIL, expected 2 messages erased, got %d", erased)
+    }
+    if erased, _ := brain.EraseAuthor("alice"); erased != 0 {
+        t.Errorf("FAIL, expected nothing left to erase, got %d", erased)
+    }
+
+    if !brain.chain.Equal(expected.chain) {
+        t.Errorf("FAIL, expected: %#v, got: %#v", expected, brain)
+    } else if !reflect.DeepEqual(brain.provenance.Records("bob"), expected.provenance.Records("bob")) {
+        t.Errorf("FAIL, expected: %#v, got: %#v", expected.provenance, brain.provenance)
+    } else {
+        t.Log("Passed")
+    }
+}
+
+func TestTrainFrom(t *testing.T) {
+    tables := []struct {
+        testcase string
+        format   chatbrains.Format
+        input    string
+        expected chatbrains.TrainStats
+    }{
+        {"Text", chatbrains.FormatText, "test data test data\ndata test data\n\ntest data\n", chatbrains.TrainStats{Messages: 3, Tokens: 15, Skipped: 1}},
+        {"JSONL", chatbrains.FormatJSONL, "{\"text\":\"test data test data\"}\n{\"text\":\"data test data\",\"author\":\"alice\"}\n{\"text\":\"test data\"}\n{}\n", chatbrains.TrainStats{Messages: 3, Tokens: 15, Skipped: 1}},
+        {"CSV", chatbrains.FormatCSV, "text\ntest data test data\ndata test data\ntest data\n", chatbrains.TrainStats{Messages: 3, Tokens: 15, Skipped: 0}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        expected := newBrain(2, 32)
+        brain := new(Brain)
+        brain.Init(2, 32)
+
+        got, err := brain.TrainFrom(strings.NewReader(table.input), table.format, nil)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if got != table.expected {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+        } else if !brain.chain.Equal(expected.chain) {
+            t.Errorf("FAIL, brain not trained as expected, got: %#v", brain)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestTrainParallel(t *testing.T) {
+    var input strings.Builder
+    for i := 0; i < 500; i++ {
+        fmt.Fprintf(&input, "{\"text\":\"test data %d test data\",\"author\":\"user%d\"}\n{}\n", i, i%3)
+    }
+
+    tables := []struct {
+        testcase string
+        workers  int
+    }{
+        {"One worker", 1},
+        {"Several workers", 4},
+        {"One worker per CPU", 0},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        expected := new(Brain)
+        expected.Init(2, 32)
+        expectedStats, _ := expected.TrainFrom(strings.NewReader(input.String()), chatbrains.FormatJSONL, nil)
+
+        brain := new(Brain)
+        brain.Init(2, 32)
+        got, err := brain.TrainParallel(strings.NewReader(input.String()), chatbrains.FormatJSONL, table.workers, nil)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if got != expectedStats {
+            t.Errorf("FAIL, expected: %#v, got: %#v", expectedStats, got)
+        } else if !brain.chain.Equal(expected.chain) {
+            t.Errorf("FAIL, brain not trained as expected")
+        } else if n := len(brain.provenance.Records("user1")); n != len(expected.provenance.Records("user1")) {
+            t.Errorf("FAIL, expected %d records for user1, got: %d", len(expected.provenance.Records("user1")), n)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestMerge(t *testing.T) {
+    tables := []struct {
+        testcase    string
+        order       int
+        weight      int
+        otherWeight int
+        errors      bool
+    }{
+        {"Equal weights", 2, 1, 1, false},
+        {"Weighted", 2, 2, 3, false},
+        {"Different orders", 1, 1, 1, true},
+        {"Zero weight", 2, 0, 1, true},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(2, 32)
+        brain.Train("test data test data")
+        other := new(Brain)
+        other.Init(table.order, 32)
+        other.TrainWithMeta("data test data", chatbrains.Meta{AuthorID: "alice"})
+
+        expected := markovchain.NewChain(2)
+        expected.AddWeighted(chatbrains.ProcessString("test data test data"), table.weight)
+        expected.AddWeighted(chatbrains.ProcessString("data test data"), table.otherWeight)
+
+        err := brain.MergeWeighted(other, table.weight, table.otherWeight)
+        if (err != nil) != table.errors {
+            t.Errorf("FAIL, expected errors: %v, got: %v", table.errors, err)
+        } else if table.errors {
+            t.Log("Passed")
+        } else if !brain.chain.Equal(expected) {
+            t.Errorf("FAIL, brain not merged as expected, got: %#v", brain)
+        } else if len(brain.provenance.Records("alice")) != 1 {
+            t.Errorf("FAIL, expected alice's message to be recorded, got: %#v", brain.provenance.Records("alice"))
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestMergeDecay(t *testing.T) {
+    brain := new(Brain)
+    brain.Init(2, 32)
+    brain.EnableDecay(time.Hour)
+    other := newBrain(2, 32)
+
+    if err := brain.Merge(other); err != nil {
+        t.Fatalf("FAIL, unexpected error: %v", err)
+    }
+    expected := newBrain(2, 32)
+    expected.chain.Scale(chatbrains.DecayResolution)
+    if !brain.chain.Equal(expected.chain) {
+        t.Errorf("FAIL, expected counts scaled to decay resolution, got: %#v", brain)
+    }
+    if err := other.Merge(brain); err == nil {
+        t.Errorf("FAIL, expected an error merging a decaying brain into one without decay")
+    }
+}
+
+func TestGenerateFor(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+        expected string
+    }{
+        {"Order 1", 1, `(?i)\bnode\b`},
+        //The subject from memory should be padded to the order, or the
+        //reply couldn't carry on from it
+        {"Order 2", 2, `(?i)\bnode graph\b`},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := newBrain(table.order, 32)
+        brain.Train("a node graph")
+        memory := chatbrains.NewMemory(4, time.Hour)
+        brain.SetMemory(memory)
+
+        memory.Remember("chat", "the node")
+        got, err := brain.GenerateFor("chat", "and the")
+        t.Logf("Got: %s", got)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if match, _ := regexp.Match(table.expected, []byte(got)); !match {
+            t.Errorf("FAIL, expected a reply about node, got: %#v", got)
+        }
+
+        context := memory.Context("chat")
+        expected := append(append(chatbrains.ProcessString("the node"), chatbrains.ProcessString("and the")...), chatbrains.ProcessString(got)...)
+        if !reflect.DeepEqual(context, expected) {
+            t.Errorf("FAIL, expected the prompt and reply to be remembered, got: %#v", context)
+        }
+
+        //Other conversations shouldn't be affected
+        if len(memory.Context("other")) != 0 {
+            t.Errorf("FAIL, expected nothing remembered for another chat")
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestSentenceSplitting(t *testing.T) {
+    tables := []struct {
+        testcase string
+        split    bool
+        input    string
+        expected []string
+    }{
+        {"Not split", false, "Test data. Data test!", []string{"Test data. Data test!"}},
+        {"Split", true, "Test data. Data test!", []string{"Test data.", "Data test!"}},
+        {"Split, one sentence", true, "Test data", []string{"Test data"}},
+        {"Split, empty message", true, "", []string{""}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := newBrain(2, 32)
+        brain.SetSentenceSplitting(table.split)
+        expected := newBrain(2, 32)
+        before, _ := brain.MarshalJSON()
+        for _, sentence := range table.expected {
+            expected.Train(sentence)
+        }
+
+        brain.Train(table.input)
+        if !brain.chain.Equal(expected.chain) {
+            t.Errorf("FAIL, brain not trained as expected, got: %#v", brain)
+        } else if err := brain.Untrain(table.input); err != nil {
+            t.Errorf("FAIL, unable to untrain: %v", err)
+        } else if after, _ := brain.MarshalJSON(); string(after) != string(before) {
+            t.Errorf("FAIL, expected: %s, got: %s", before, after)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestMaxSentences(t *testing.T) {
+    tables := []struct {
+        testcase     string
+        maxSentences int
+        lengthLimit  int
+        expected     string
+    }{
+        {"Default", 0, 64, `^((Test)|(Data))( ((test)|(data)))*\.$`},
+        {"One", 1, 64, `^((Test)|(Data))( ((test)|(data)))*\.$`},
+        {"Several", 3, 64, `^((Test)|(Data))( ((test)|(data)))*\.( ((Test)|(Data))( ((test)|(data)))*\.){2}$`},
+        {"No room", 3, 6, `^((Test)|(Data))[^A-Z]*$`},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(2, table.lengthLimit)
+        brain.Train("Test data test.")
+        brain.Train("Data test.")
+        brain.SetMaxSentences(table.maxSentences)
+
+        //Should survive a save and load
+        b, _ := brain.MarshalJSON()
+        brain = new(Brain)
+        brain.UnmarshalJSON(b)
+
+        got, err := brain.Generate("")
+        t.Logf("Got: %s", got)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if match, _ := regexp.Match(table.expected, []byte(got)); !match {
+            t.Errorf("FAIL, expected: %s, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestLimits(t *testing.T) {
+    tables := []struct {
+        testcase string
+        limits   chatbrains.Limits
+    }{
+        {"Words", chatbrains.Limits{MaxWords: 4}},
+        {"Characters", chatbrains.Limits{MaxChars: 20}},
+        {"Both", chatbrains.Limits{MaxWords: 6, MaxChars: 25}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(1, 8)
+        brain.Train("test data test data test data test data test data test data.")
+        brain.Train("data test, data test data test data test data test data test!")
+        brain.SetLimits(table.limits)
+        brain.SetMaxSentences(3)
+
+        //Should survive a save and load
+        b, _ := brain.MarshalJSON()
+        brain = new(Brain)
+        brain.UnmarshalJSON(b)
+
+        for i := 0; i < 50; i++ {
+            got, err := brain.Generate("test")
+            words := chatbrains.CountWords(chatbrains.ProcessString(got))
+            if err != nil {
+                t.Errorf("FAIL, unexpected error: %v", err)
+            } else if (table.limits.MaxWords > 0 && words > table.limits.MaxWords) || (table.limits.MaxChars > 0 && len(got) > table.limits.MaxChars) {
+                t.Errorf("FAIL, expected a reply within %#v, got: %#v", table.limits, got)
+            } else if strings.HasSuffix(got, " ") || strings.HasSuffix(got, ",") {
+                t.Errorf("FAIL, expected a reply ending at a natural boundary, got: %#v", got)
+            }
+        }
+    }
+}
+
+func TestMinLength(t *testing.T) {
+    tables := []struct {
+        testcase string
+        limits   chatbrains.Limits
+    }{
+        {"Resample", chatbrains.Limits{MinWords: 4, Strategy: chatbrains.Resample, Retries: 50}},
+        {"Suppress end", chatbrains.Limits{MinWords: 4, Strategy: chatbrains.SuppressEnd, Retries: 50}},
+        {"With a maximum", chatbrains.Limits{MinWords: 4, MaxWords: 12, Strategy: chatbrains.SuppressEnd, Retries: 50}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(1, 30)
+        brain.Train("test")
+        brain.Train("test data test data test data test data")
+        brain.SetLimits(table.limits)
+
+        //Should survive a save and load
+        b, _ := brain.MarshalJSON()
+        brain = new(Brain)
+        brain.UnmarshalJSON(b)
+
+        for i := 0; i < 50; i++ {
+            got, err := brain.Generate("test")
+            words := chatbrains.CountWords(chatbrains.ProcessString(got))
+            if err != nil {
+                t.Errorf("FAIL, unexpected error: %v", err)
+            } else if words < table.limits.MinWords {
+                t.Errorf("FAIL, expected at least %v words, got: %#v", table.limits.MinWords, got)
+            } else if table.limits.MaxWords > 0 && words > table.limits.MaxWords {
+                t.Errorf("FAIL, expected at most %v words, got: %#v", table.limits.MaxWords, got)
+            }
+        }
+    }
+}
+
+func TestNoveltyGuard(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+        messages []string
+    }{
+        {"Overlapping messages", 1, []string{"the cat sat on the mat", "the dog sat on the log", "a cat ate the fish", "a dog ate the bone"}},
+        {"One message", 2, []string{"the quick brown fox jumps over the lazy dog"}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(table.order, 30)
+        brain.SetNoveltyGuard(chatbrains.NewNoveltyGuard(3, 20))
+        expected := chatbrains.NewNoveltyGuard(3, 20)
+        for _, message := range table.messages {
+            brain.Train(message)
+            expected.Add(chatbrains.ProcessString(message))
+        }
+
+        //Should survive a save and load
+        b, _ := brain.MarshalJSON()
+        brain = new(Brain)
+        brain.UnmarshalJSON(b)
+
+        for i := 0; i < 50; i++ {
+            got, err := brain.Generate("cat")
+            if err != nil {
+                t.Errorf("FAIL, unexpected error: %v", err)
+            } else if !expected.Novel(chatbrains.ProcessString(got)) {
+                t.Errorf("FAIL, expected a novel reply, got: %#v", got)
+            }
+        }
+    }
+}
+
+func TestNoveltyGuardExhausted(t *testing.T) {
+    brain := new(Brain)
+    brain.Init(1, 30)
+    brain.SetNoveltyGuard(chatbrains.NewNoveltyGuard(1, 3))
+    brain.Train("quick-brown")
+
+    //The only reply is the message itself
+    got, err := brain.GenerateDetailed("quick")
+    if err != chatbrains.ErrNotNovel {
+        t.Errorf("FAIL, expected ErrNotNovel, got: %v", err)
+    } else if got.Text != "" || got.StopReason != chatbrains.StopNotNovel {
+        t.Errorf("FAIL, expected an empty reply that wasn't novel, got: %#v", got)
+    } else {
+        t.Log("Passed")
+    }
+}
+
+func TestNoveltyGuardUntrain(t *testing.T) {
+    brain := new(Brain)
+    brain.Init(1, 30)
+    brain.SetNoveltyGuard(chatbrains.NewNoveltyGuard(2, 5))
+    brain.Train("test data test data")
+    brain.Untrain("test data test data")
+
+    if !brain.novelty.Novel(chatbrains.ProcessString("Test data test")) {
+        t.Errorf("FAIL, expected untrained messages to be removed from the index")
+    }
+}
+
+func TestRedactor(t *testing.T) {
+    brain := new(Brain)
+    brain.Init(1, 30)
+    brain.SetRedactor(chatbrains.NewRedactor())
+
+    //Should survive a save and load
+    b, _ := brain.MarshalJSON()
+    brain = new(Brain)
+    brain.UnmarshalJSON(b)
+
+    brain.Train("mail me at jo@example.com")
+    brain.Train("or mail me on 07700900123")
+    for i := 0; i < 50; i++ {
+        got, err := brain.Generate("mail")
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if strings.Contains(got, "example") || strings.Contains(got, "07700900123") {
+            t.Errorf("FAIL, expected personal information to be redacted, got: %#v", got)
+        }
+    }
+
+    //Placeholders are only kept whole by brains that redact
+    if p, _ := brain.chain.TransitionProbability("<email>", markovchain.NGram{" "}); p == 0 {
+        t.Errorf("FAIL, expected <email> to be trained as one token")
+    }
+    plain := new(Brain)
+    plain.Init(1, 30)
+    plain.Train("mail me at <email>")
+    if p, _ := plain.chain.TransitionProbability("<email>", markovchain.NGram{" "}); p != 0 {
+        t.Errorf("FAIL, expected <email> to be split without a redactor")
+    }
+
+    if err := brain.Untrain("mail me at jo@example.com"); err != nil {
+        t.Errorf("FAIL, unable to untrain a redacted message: %v", err)
+    }
+}
+
+func TestGenerateWithSlots(t *testing.T) {
+    tables := []struct {
+        testcase string
+        filler   chatbrains.SlotFiller
+        expected string
+    }{
+        {"Map", chatbrains.SlotMap(map[string]string{"user": "Alice"}), "alice"},
+        {"Callback", func(slot string) (string, bool) { return "Bob", true }, "bob"},
+        {"Defaults", nil, "someone"},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(1, 30)
+        brain.Train("hello <user> how are you")
+
+        found := false
+        for i := 0; i < 50; i++ {
+            got, err := brain.GenerateWithSlots("hello", table.filler)
+            if err != nil {
+                t.Errorf("FAIL, unexpected error: %v", err)
+            } else if strings.Contains(got, "<") {
+                t.Errorf("FAIL, expected slots to be filled, got: %#v", got)
+            }
+            found = found || strings.Contains(strings.ToLower(got), table.expected)
+        }
+        if !found {
+            t.Errorf("FAIL, expected %#v in a reply", table.expected)
+        }
+    }
+}
+
+func TestGenerateSlots(t *testing.T) {
+    tables := []struct {
+        testcase string
+        redactor *chatbrains.Redactor
+        expected string
+    }{
+        {"Without a redactor", nil, "<user>"},
+        {"With a redactor", chatbrains.NewRedactor(), "someone"},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(1, 30)
+        brain.SetRedactor(table.redactor)
+        brain.Train("hello <user> how are you")
+
+        found := false
+        for i := 0; i < 50; i++ {
+            got, err := brain.Generate("hello")
+            if err != nil {
+                t.Errorf("FAIL, unexpected error: %v", err)
+            }
+            found = found || strings.Contains(got, table.expected)
+        }
+        if !found {
+            t.Errorf("FAIL, expected %#v in a reply", table.expected)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestGenerateDetailed(t *testing.T) {
+    tables := []struct {
+        testcase    string
+        lengthLimit int
+        message     string
+        prompt      string
+        expected    chatbrains.StopReason
+    }{
+        {"End", 30, "test data", "test", chatbrains.StopEnd},
+        {"Length", 6, "test,alpha;bravo:charlie-delta/echo", "test", chatbrains.StopLength},
+        {"Unknown", 30, "test data", "unknown", chatbrains.StopUnknown},
+        {"Filtered", 30, "test crap", "test", chatbrains.StopFiltered},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        brain.Init(1, table.lengthLimit)
+        brain.Train(table.message)
+
+        got, err := brain.GenerateDetailed(table.prompt)
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if got.StopReason != table.expected {
+            t.Errorf("FAIL, expected stop reason: %v, got: %#v", table.expected, got)
+        } else if len(got.Probabilities) != len(got.Tokens) || got.Text != strings.Join(got.Tokens, "") {
+            t.Errorf("FAIL, expected a probability for each token of the text, got: %#v", got)
+        } else if !reflect.DeepEqual(got.Subject, []string{table.prompt}) {
+            t.Errorf("FAIL, expected subject: %#v, got: %#v", table.prompt, got.Subject)
+        } else if got.Probability() <= 0 || got.Probability() > 1 {
+            t.Errorf("FAIL, expected a probability between 0 and 1, got: %v", got.Probability())
+        } else if got.Duration <= 0 {
+            t.Errorf("FAIL, expected a duration, got: %v", got.Duration)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestExplain(t *testing.T) {
+    brain := new(Brain)
+    //Long enough that it's sure to reach an end token
+    brain.Init(1, 200)
+    brain.Train("test data test")
+    brain.Train("test node")
+
+    got, err := brain.Explain("test")
+    if err != nil {
+        t.Fatalf("FAIL, unexpected error: %v", err)
+    }
+    if got.Trace == nil || len(got.Trace.Steps) == 0 {
+        t.Fatalf("FAIL, expected a trace, got: %#v", got)
+    }
+
+    //Every token after the subject should have been picked by a step
+    chosen := []string{}
+    for _, step := range got.Trace.Steps {
+        if step.Note != "" {
+            continue
+        }
+        if _, ok := step.Candidates[step.Chosen]; !ok {
+            t.Errorf("FAIL, expected %#v to be a candidate, got: %#v", step.Chosen, step)
+        }
+        chosen = append(chosen, step.Chosen)
+    }
+    expected := append(append([]string{}, got.Tokens[1:]...), markovchain.EndToken)
+    expected[0] = strings.ToLower(expected[0])
+    if !reflect.DeepEqual(chosen, expected) {
+        t.Errorf("FAIL, expected steps: %#v, got: %#v", expected, chosen)
+    }
+    if last := got.Trace.Steps[len(got.Trace.Steps)-1]; last.Stop != got.StopReason {
+        t.Errorf("FAIL, expected the last step to stop with %v, got: %#v", got.StopReason, last)
+    }
+
+    if _, err := got.Trace.JSON(); err != nil {
+        t.Errorf("FAIL, unable to export trace as JSON: %v", err)
+    }
+    var b bytes.Buffer
+    if err := got.Trace.WriteTable(&b); err != nil {
+        t.Errorf("FAIL, unable to export trace as a table: %v", err)
+    }
+
+    //Plain replies shouldn't pay for a trace
+    if reply, _ := brain.GenerateDetailed("test"); reply.Trace != nil {
+        t.Errorf("FAIL, expected no trace, got: %#v", reply.Trace)
+    }
+}
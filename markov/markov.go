@@ -1,23 +1,25 @@
 package markov
 
 import (
+    "bytes"
 	"encoding/json"
-	"github.com/mb-14/gomarkov"
+    "fmt"
     "github.com/TwinProduction/go-away"
 	log "github.com/sirupsen/logrus"
+    "io"
     "regexp"
-	"strings"
     chatbrains "github.com/MattChubb/chatbrains"
+    "github.com/MattChubb/chatbrains/markovchain"
 )
 
 type Brain struct {
-    chain       *gomarkov.Chain
-    lengthLimit int
+    Base
+    chain *markovchain.Chain
 }
 
 type brainJSON struct {
-    Chain       *gomarkov.Chain
-    LengthLimit int
+    Chain *markovchain.Chain
+    Settings
 }
 
 func (brain Brain) MarshalJSON() ([]byte, error) {
@@ -25,70 +27,192 @@ func (brain Brain) MarshalJSON() ([]byte, error) {
 
     obj := brainJSON{
         brain.chain,
-        brain.lengthLimit,
+        brain.Settings(),
     }
 
     return json.Marshal(obj)
 }
 
 func (brain *Brain) UnmarshalJSON(b []byte) error {
-	var obj brainJSON
-	err := json.Unmarshal(b, &obj)
-	if err != nil {
-		return err
-	}
+    return brain.DecodeJSON(json.NewDecoder(bytes.NewReader(b)))
+}
+
+//DecodeJSON reads a brain saved with MarshalJSON from the next value in
+//decoder, streaming the chain rather than holding the raw JSON in memory
+func (brain *Brain) DecodeJSON(decoder *json.Decoder) error {
+    var obj brainJSON
+    err := chatbrains.DecodeObject(decoder, func(key string) error {
+        if key == "Chain" {
+            obj.Chain = new(markovchain.Chain)
+            return obj.Chain.DecodeJSON(decoder)
+        }
+        return DecodeSetting(decoder, key, &obj.Settings)
+    })
+    if err != nil {
+        return err
+    }
+    if obj.Chain == nil {
+        return fmt.Errorf("Saved brain has no chain")
+    }
 
-    brain.lengthLimit = obj.LengthLimit
     brain.chain = obj.Chain
+    brain.Base = NewBase(brain, single{brain.chain}, obj.Settings)
     log.Debug("Braindump: ", brain)
 
     return nil
 }
 
+//Load reads a brain saved with MarshalJSON from r
+func (brain *Brain) Load(r io.Reader) error {
+    return brain.DecodeJSON(json.NewDecoder(r))
+}
+
 func (brain *Brain) Init(order int, lengthLimit int) {
-	brain.chain = gomarkov.NewChain(order)
-    brain.lengthLimit = lengthLimit
+	brain.chain = markovchain.NewChain(order)
+    brain.Base = NewBase(brain, single{brain.chain}, Settings{LengthLimit: lengthLimit})
     log.Debug("Braindump: ", brain)
 }
 
-func (brain *Brain) Train(data string) error {
-    log.Debug("Braindump: ", brain)
-    log.Debug("Training data: ", data)
-    processedData := chatbrains.ProcessString(data)
-    log.Debug("Processed into: ", processedData)
-    brain.chain.Add(processedData)
-    return nil
+//Merge adds everything other has been trained on to the brain. Both brains
+//must have the same order.
+func (brain *Brain) Merge(other *Brain) error {
+    return brain.MergeWeighted(other, 1, 1)
+}
+
+//MergeWeighted is Merge, but with the brain's existing counts multiplied by
+//weight and other's by otherWeight, so one source can count for more than
+//the other
+func (brain *Brain) MergeWeighted(other *Brain, weight int, otherWeight int) error {
+    return brain.Base.MergeWeighted(&other.Base, weight, otherWeight)
 }
 
-func (brain *Brain) Generate(prompt string) (string, error) {
-    log.Debug("Input: ", prompt)
-    processedPrompt := chatbrains.ProcessString(prompt)
-    log.Debug("Processed into: ", processedPrompt)
+//Stats describes what the brain has learned, for monitoring, listing its
+//DefaultTop most frequent tokens and n-grams. With decay enabled, counts are
+//in units of DecayResolution per message.
+func (brain *Brain) Stats() markovchain.Stats {
+    return brain.StatsTop(markovchain.DefaultTop)
+}
 
-	subject := []string{}
-	if len(processedPrompt) > 0 {
-		subject = chatbrains.ExtractSubject(processedPrompt, brain.chain.Order)
-	}
-	//TODO Any other clever Markov hacks?
-	sentence := brain.generateSentence(subject)
-    sentence[0] = strings.Title(sentence[0])
-    return strings.Join(sentence, ""), nil
+//StatsTop is Stats, but listing the top most frequent tokens and n-grams
+func (brain *Brain) StatsTop(top int) markovchain.Stats {
+    return brain.chain.Stats(top)
+}
+
+//single is the Chains of a brain that generates forwards from its subject
+type single struct {
+    chain *markovchain.Chain
+}
+
+func (chains single) Order() int {
+    return chains.chain.Order
+}
+
+func (chains single) Forward() (*markovchain.Chain, string) {
+    return chains.chain, ""
+}
+
+func (chains single) Add(tokens []string, weight int) {
+    chains.chain.AddWeighted(tokens, weight)
+}
+
+func (chains single) Contains(tokens []string) bool {
+    return chains.chain.Contains(tokens)
+}
+
+func (chains single) Remove(tokens []string, weight int) error {
+    return chains.chain.Remove(tokens, weight)
+}
+
+func (chains single) Scale(factor float64) {
+    chains.chain.Scale(factor)
+}
+
+func (chains single) Prune(threshold int) {
+    chains.chain.Prune(threshold)
 }
 
-func (brain *Brain) generateSentence(init []string) []string {
+func (chains single) Empty() Chains {
+    return single{markovchain.NewChain(chains.chain.Order)}
+}
+
+func (chains single) Merge(other Chains, weight int) error {
+    return chains.chain.Merge(other.(single).chain, weight)
+}
+
+func (chains single) Sentence(subject []string, lengthLimit int, limits chatbrains.Limits, trace *chatbrains.Trace) Draft {
+    return GenerateSentence(chains.chain, "", subject, lengthLimit, limits, trace)
+}
+
+//GenerateSentence generates a sentence from chain, starting after init, of at
+//most lengthLimit tokens, or within limits if they're bounded. Steps are
+//traced as taken by a chain called name.
+func GenerateSentence(chain *markovchain.Chain, name string, init []string, lengthLimit int, limits chatbrains.Limits, trace *chatbrains.Trace) Draft {
     log.Debug("Input: ", init)
-    order := brain.chain.Order
+    order := chain.Order
     tokens := GenerateInitialToken(init, order)
     log.Debug("Initial token: ", tokens)
+    probabilities := certain(len(tokens))
+    stop := chatbrains.StopLength
 
-	for tokens[len(tokens)-1] != gomarkov.EndToken &&
-		len(tokens) < brain.lengthLimit {
-        next := GenerateNextToken(brain.chain, tokens)
+    retries := limits.RetryBudget()
+	for tokens[len(tokens)-1] != markovchain.EndToken &&
+		!full(tokens, lengthLimit, limits) {
+        next, probability, reason := nextTokenWithin(chain, tokens, limits, &retries)
+        traceStep(trace, name, chain, tokens, next, reason)
         tokens = append(tokens, next)
+        probabilities = append(probabilities, probability)
+        if reason != "" {
+            stop = reason
+        }
 	}
 
+    if tokens[len(tokens)-1] != markovchain.EndToken && limits.Bounded() {
+        //Keep the token that went over the limit, so that Fit can find the
+        //best place to cut the reply
+        tokens = append(tokens, markovchain.EndToken)
+        probabilities = append(probabilities, 0)
+    }
+
 	//Don't include the start or end token in our response
-    return TrimTokens(tokens)
+    trimmed := TrimTokens(tokens)
+    skipped := len(tokens) - 1 - len(trimmed)
+    return Draft{trimmed, probabilities[skipped : len(tokens)-1], stop}
+}
+
+//padContext returns the last order tokens of tokens, padded with start
+//tokens if there aren't enough
+func padContext(tokens []string, order int) []string {
+    if len(tokens) >= order {
+        return tokens[len(tokens)-order:]
+    }
+    return append(GenerateInitialToken([]string{}, order-len(tokens)), tokens...)
+}
+
+//traceStep records picking next after tokens in trace, along with everything
+//else chain could have picked
+func traceStep(trace *chatbrains.Trace, name string, chain *markovchain.Chain, tokens []string, next string, reason chatbrains.StopReason) {
+    if trace == nil {
+        return
+    }
+    context := append([]string{}, tokens[len(tokens)-chain.Order:]...)
+    candidates, _ := chain.Successors(context)
+    trace.Add(chatbrains.Step{
+        Chain:      name,
+        Context:    context,
+        Candidates: candidates,
+        Chosen:     next,
+        Stop:       reason,
+    })
+}
+
+//certain returns the probabilities of n tokens that weren't picked by a
+//chain, such as a subject
+func certain(n int) []float64 {
+    probabilities := make([]float64, n)
+    for i := range probabilities {
+        probabilities[i] = 1
+    }
+    return probabilities
 }
 
 //Exported so that DoubleMarkov can also use it
@@ -98,7 +222,7 @@ func GenerateInitialToken(init []string, order int) []string {
     // The length of our initialisation chain needs to match the Markov order
 	if len(init) < order {
 		for i := 0; i < order - len(init) ; i++ {
-			tokens = append(tokens, gomarkov.StartToken)
+			tokens = append(tokens, markovchain.StartToken)
 		}
 		tokens = append(tokens, init...)
 	} else if len(init) > order {
@@ -110,27 +234,69 @@ func GenerateInitialToken(init []string, order int) []string {
     return tokens
 }
 
+//full reports whether a sentence being generated has reached its length
+//limit: lengthLimit tokens, or just over the maximum if limits sets one
+func full(tokens []string, lengthLimit int, limits chatbrains.Limits) bool {
+    if !limits.Bounded() {
+        return len(tokens) >= lengthLimit
+    }
+    for len(tokens) > 0 && tokens[0] == markovchain.StartToken {
+        tokens = tokens[1:]
+    }
+    return len(tokens) >= limits.TokenLimit() || limits.Exceeded(tokens)
+}
+
 func TrimTokens(tokens []string) []string {
 	tokens = tokens[:len(tokens)-1]
-	for tokens[0] == gomarkov.StartToken {
+	for len(tokens) > 0 && tokens[0] == markovchain.StartToken {
 		tokens = tokens[1:]
 	}
 	return tokens
 }
 
-func GenerateNextToken(chain *gomarkov.Chain, tokens []string) string {
-    next, err := chain.Generate(tokens[(len(tokens) - chain.Order):])
+//nextTokenWithin is nextToken, but with the SuppressEnd strategy it tries
+//again whenever the sentence would end short of the minimum, using up
+//retries as it goes
+func nextTokenWithin(chain *markovchain.Chain, tokens []string, limits chatbrains.Limits, retries *int) (string, float64, chatbrains.StopReason) {
+    next, probability, reason := nextToken(chain, tokens)
+    if limits.Strategy != chatbrains.SuppressEnd {
+        return next, probability, reason
+    }
+    for next == markovchain.EndToken && *retries > 0 && limits.Short(tokens) {
+        *retries--
+        next, probability, reason = nextToken(chain, tokens)
+    }
+    return next, probability, reason
+}
+
+func GenerateNextToken(chain *markovchain.Chain, tokens []string) string {
+    next, _, _ := nextToken(chain, tokens)
+    return next
+}
+
+//nextToken is GenerateNextToken, but also returns how likely the token was
+//to be picked, and if it's an end token, why generation stopped
+func nextToken(chain *markovchain.Chain, tokens []string) (string, float64, chatbrains.StopReason) {
+    current := tokens[(len(tokens) - chain.Order):]
+    next, err := chain.Generate(current)
     if err != nil {
         errormsg := err.Error()
         if match, _ := regexp.Match(`Unknown ngram.*`, []byte(errormsg)); !match {
             log.Fatal("Error generating from Markov chain: ", errormsg)
         }
+        return markovchain.EndToken, 0, chatbrains.StopUnknown
     }
 
     //TODO Implement a replacement wordfilter instead of just removing profanity
-    if len(next) > 0 && ! goaway.IsProfane(next) {
-        return next
-    } else {
-        return gomarkov.EndToken
+    if len(next) == 0 {
+        return markovchain.EndToken, 0, chatbrains.StopEnd
+    }
+    probability, _ := chain.TransitionProbability(next, current)
+    if goaway.IsProfane(next) {
+        return markovchain.EndToken, probability, chatbrains.StopFiltered
+    }
+    if next == markovchain.EndToken {
+        return next, probability, chatbrains.StopEnd
     }
+    return next, probability, ""
 }
@@ -1,11 +1,16 @@
 package markov
 
 import (
+    "bytes"
+    "fmt"
 	log "github.com/sirupsen/logrus"
 	"testing"
 	"reflect"
     "regexp"
-	"github.com/mb-14/gomarkov"
+    "github.com/MattChubb/chatbrains/markovchain"
+    "strings"
+    chatbrains "github.com/MattChubb/chatbrains"
+    "github.com/MattChubb/chatbrains/internal/benchdata"
 )
 
 func TestMain(m *testing.M) {
@@ -149,15 +154,15 @@ func TestGenerateSentence(t *testing.T) {
 		t.Logf("Testing: %s", table.testcase)
         brain := newBrain(table.order, length)
 
-		got := brain.generateSentence(table.input)
+		got := GenerateSentence(brain.chain, "", table.input, length, chatbrains.Limits{}, nil).Tokens
 
 		if len(got) < 1 {
 			t.Errorf("FAIL, prompt: %#v, got: %#v", table.input, got)
 		} else if len(got) > length {
 			t.Errorf("FAIL, response largr than lengthlimit, got: %#v", got)
-		} else if got[0] == gomarkov.StartToken {
+		} else if got[0] == markovchain.StartToken {
 			t.Errorf("FAIL, start token found, got: %#v", got)
-		} else if got[len(got)-1] == gomarkov.EndToken {
+		} else if got[len(got)-1] == markovchain.EndToken {
 			t.Errorf("FAIL, end token found, got: %#v", got)
 		}
 
@@ -270,3 +275,137 @@ func TestGenerateInitialToken(t *testing.T) {
 		}
     }
 }
+
+func TestLoad(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+    }{
+        {"Order 1", 1},
+        {"Order 2", 2},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        expected := newBrain(table.order, 31)
+        saved, _ := expected.MarshalJSON()
+
+        brain := new(Brain)
+        if err := brain.Load(bytes.NewReader(saved)); err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+            continue
+        }
+        got, _ := brain.MarshalJSON()
+        if string(got) != string(saved) {
+            t.Errorf("FAIL, expected: %s, got: %s", saved, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestLoadErrors(t *testing.T) {
+    tables := []struct {
+        testcase string
+        input    string
+    }{
+        {"Truncated JSON", `{"LengthLimit":31,`},
+        {"Empty object", `{}`},
+        {"No chain", `{"LengthLimit":31}`},
+        {"A doublemarkov brain", `{"BckChain":{"int":1,"spool_map":{},"freq_mat":{}},"FwdChain":{"int":1,"spool_map":{},"freq_mat":{}},"LengthLimit":31}`},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        brain := new(Brain)
+        if err := brain.Load(strings.NewReader(table.input)); err == nil {
+            t.Errorf("FAIL, expected an error loading %s", table.input)
+        } else {
+            t.Logf("Passed (%v)", err)
+        }
+    }
+}
+
+func TestStats(t *testing.T) {
+    brain := new(Brain)
+    brain.Init(1, 30)
+    brain.Train("test data")
+    brain.Train("test node")
+
+    got := brain.Stats()
+    if got.Order != 1 || got.Vocabulary != 4 || got.TotalCount != 8 {
+        t.Errorf("FAIL, expected order 1, 4 tokens and 8 transitions, got: %#v", got)
+    } else if got.TopTokens[0] != (markovchain.Count{State: " ", Count: 2}) && got.TopTokens[0] != (markovchain.Count{State: "test", Count: 2}) {
+        t.Errorf("FAIL, expected the most frequent token to be seen twice, got: %#v", got.TopTokens)
+    }
+    if got := brain.StatsTop(1); len(got.TopTokens) != 1 || len(got.TopNGrams) != 1 {
+        t.Errorf("FAIL, expected only the top token and n-gram, got: %#v and %#v", got.TopTokens, got.TopNGrams)
+    }
+}
+
+//benchBrains calls fn with a brain trained on each corpus at each order
+func benchBrains(b *testing.B, fn func(b *testing.B, brain *Brain, messages []string)) {
+    for _, corpus := range benchdata.Corpora(b) {
+        for _, order := range benchdata.Orders {
+            brain := new(Brain)
+            brain.Init(order, 30)
+            for _, message := range corpus.Messages {
+                brain.Train(message)
+            }
+            messages := corpus.Messages
+            b.Run(fmt.Sprintf("%s/order-%d", corpus.Name, order), func(b *testing.B) {
+                fn(b, brain, messages)
+            })
+        }
+    }
+}
+
+func BenchmarkTrain(b *testing.B) {
+    for _, corpus := range benchdata.Corpora(b) {
+        for _, order := range benchdata.Orders {
+            messages := corpus.Messages
+            b.Run(fmt.Sprintf("%s/order-%d", corpus.Name, order), func(b *testing.B) {
+                brain := new(Brain)
+                brain.Init(order, 30)
+                b.ResetTimer()
+                for i := 0; i < b.N; i++ {
+                    brain.Train(messages[i%len(messages)])
+                }
+            })
+        }
+    }
+}
+
+func BenchmarkGenerate(b *testing.B) {
+    benchBrains(b, func(b *testing.B, brain *Brain, messages []string) {
+        for i := 0; i < b.N; i++ {
+            brain.Generate(messages[i%len(messages)])
+        }
+    })
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+    benchBrains(b, func(b *testing.B, brain *Brain, messages []string) {
+        for i := 0; i < b.N; i++ {
+            saved, err := brain.MarshalJSON()
+            if err != nil {
+                b.Fatalf("FAIL, unable to marshal brain: %v", err)
+            }
+            b.SetBytes(int64(len(saved)))
+        }
+    })
+}
+
+func BenchmarkUnmarshalJSON(b *testing.B) {
+    benchBrains(b, func(b *testing.B, brain *Brain, messages []string) {
+        saved, err := brain.MarshalJSON()
+        if err != nil {
+            b.Fatalf("FAIL, unable to marshal brain: %v", err)
+        }
+        b.SetBytes(int64(len(saved)))
+        b.ResetTimer()
+        for i := 0; i < b.N; i++ {
+            if err := new(Brain).UnmarshalJSON(saved); err != nil {
+                b.Fatalf("FAIL, unable to unmarshal brain: %v", err)
+            }
+        }
+    })
+}
@@ -0,0 +1,459 @@
+//Package markovchain is a fork of github.com/mb-14/gomarkov (MIT licence).
+//It keeps the same JSON format, so brains saved with gomarkov chains load
+//unchanged, but can also be decoded from a stream.
+package markovchain
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "math/rand"
+    "reflect"
+    "strconv"
+    "sync"
+    "time"
+)
+
+//Tokens are wrapped around a sequence of words to maintain the
+//start and end transition counts
+const (
+    StartToken = "$"
+    EndToken   = "^"
+)
+
+//Chain is a markov chain instance
+type Chain struct {
+    Order        int
+    statePool    *spool
+    frequencyMat map[int]sparseArray
+    lock         *sync.RWMutex
+}
+
+type chainJSON struct {
+    Order    int                 `json:"int"`
+    SpoolMap map[string]int      `json:"spool_map"`
+    FreqMat  map[int]sparseArray `json:"freq_mat"`
+}
+
+func (chain Chain) MarshalJSON() ([]byte, error) {
+    obj := chainJSON{
+        chain.Order,
+        chain.statePool.stringMap,
+        chain.frequencyMat,
+    }
+    return json.Marshal(obj)
+}
+
+func (chain *Chain) UnmarshalJSON(b []byte) error {
+    var obj chainJSON
+    err := json.Unmarshal(b, &obj)
+    if err != nil {
+        return err
+    }
+
+    chain.Order = obj.Order
+    chain.statePool = newSpool(obj.SpoolMap)
+    chain.frequencyMat = obj.FreqMat
+    if chain.frequencyMat == nil {
+        chain.frequencyMat = make(map[int]sparseArray)
+    }
+    chain.lock = new(sync.RWMutex)
+    return nil
+}
+
+//DecodeJSON reads a chain from the next value in decoder. Unlike
+//UnmarshalJSON, the raw JSON is never held in memory all at once.
+func (chain *Chain) DecodeJSON(decoder *json.Decoder) error {
+    chain.Order = 0
+    stringMap := make(map[string]int)
+    chain.frequencyMat = make(map[int]sparseArray)
+    chain.lock = new(sync.RWMutex)
+
+    err := decodeObject(decoder, func(key string) error {
+        switch key {
+        case "int":
+            return decoder.Decode(&chain.Order)
+        case "spool_map":
+            return decodeObject(decoder, func(state string) error {
+                index, err := decodeInt(decoder)
+                stringMap[state] = index
+                return err
+            })
+        case "freq_mat":
+            return decodeObject(decoder, func(row string) error {
+                current, err := strconv.Atoi(row)
+                if err != nil {
+                    return fmt.Errorf("Invalid state index %q", row)
+                }
+                arr := make(sparseArray)
+                chain.frequencyMat[current] = arr
+                return decodeObject(decoder, func(column string) error {
+                    next, err := strconv.Atoi(column)
+                    if err != nil {
+                        return fmt.Errorf("Invalid state index %q", column)
+                    }
+                    arr[next], err = decodeInt(decoder)
+                    return err
+                })
+            })
+        default:
+            var skip json.RawMessage
+            return decoder.Decode(&skip)
+        }
+    })
+    if err != nil {
+        return err
+    }
+
+    chain.statePool = newSpool(stringMap)
+    return nil
+}
+
+//Load reads a chain saved with MarshalJSON from r
+func (chain *Chain) Load(r io.Reader) error {
+    return chain.DecodeJSON(json.NewDecoder(r))
+}
+
+//NewChain creates an instance of Chain
+func NewChain(order int) *Chain {
+    chain := Chain{Order: order}
+    chain.statePool = newSpool(make(map[string]int))
+    chain.frequencyMat = make(map[int]sparseArray)
+    chain.lock = new(sync.RWMutex)
+    return &chain
+}
+
+//Add adds the transition counts to the chain for a given sequence of words
+func (chain *Chain) Add(input []string) {
+    chain.AddWeighted(input, 1)
+}
+
+//AddWeighted adds the transition counts for a sequence of words as though it
+//had been seen weight times
+func (chain *Chain) AddWeighted(input []string, weight int) {
+    startTokens := array(StartToken, chain.Order)
+    endTokens := array(EndToken, chain.Order)
+    tokens := make([]string, 0)
+    tokens = append(tokens, startTokens...)
+    tokens = append(tokens, input...)
+    tokens = append(tokens, endTokens...)
+    pairs := MakePairs(tokens, chain.Order)
+    for i := 0; i < len(pairs); i++ {
+        pair := pairs[i]
+        currentIndex := chain.statePool.add(pair.CurrentState.key())
+        nextIndex := chain.statePool.add(pair.NextState)
+        chain.lock.Lock()
+        if chain.frequencyMat[currentIndex] == nil {
+            chain.frequencyMat[currentIndex] = make(sparseArray)
+        }
+        chain.frequencyMat[currentIndex][nextIndex] += weight
+        chain.lock.Unlock()
+    }
+}
+
+//Contains reports whether the chain has every transition needed to have
+//generated a sequence of words
+func (chain *Chain) Contains(input []string) bool {
+    chain.lock.RLock()
+    defer chain.lock.RUnlock()
+    _, err := chain.transitions(input)
+    return err == nil
+}
+
+//Remove takes away the transition counts that AddWeighted added for a
+//sequence of words, forgetting any states that are no longer needed. Counts
+//that have since been scaled down are removed as far as they'll go. It's an
+//error to remove a sequence the chain has no record of.
+func (chain *Chain) Remove(input []string, weight int) error {
+    chain.lock.Lock()
+    defer chain.lock.Unlock()
+
+    //Check everything's there first, so we don't leave the chain half-edited
+    transitions, err := chain.transitions(input)
+    if err != nil {
+        return err
+    }
+
+    touched := make(map[int]bool)
+    for _, t := range transitions {
+        arr := chain.frequencyMat[t.current]
+        if arr[t.next] == 0 {
+            //Already removed as far as it'll go
+            continue
+        }
+        arr[t.next] -= weight
+        if arr[t.next] <= 0 {
+            delete(arr, t.next)
+            touched[t.next] = true
+        }
+        if len(arr) == 0 {
+            delete(chain.frequencyMat, t.current)
+            touched[t.current] = true
+        }
+    }
+    chain.release(touched)
+    return nil
+}
+
+type transition struct {
+    current int
+    next    int
+}
+
+//transitions looks up the index of every transition in a sequence of words.
+//The caller must hold the chain lock.
+func (chain *Chain) transitions(input []string) ([]transition, error) {
+    startTokens := array(StartToken, chain.Order)
+    endTokens := array(EndToken, chain.Order)
+    tokens := make([]string, 0)
+    tokens = append(tokens, startTokens...)
+    tokens = append(tokens, input...)
+    tokens = append(tokens, endTokens...)
+    pairs := MakePairs(tokens, chain.Order)
+
+    transitions := make([]transition, 0, len(pairs))
+    for _, pair := range pairs {
+        currentIndex, currentExists := chain.statePool.get(pair.CurrentState.key())
+        nextIndex, nextExists := chain.statePool.get(pair.NextState)
+        if !currentExists || !nextExists || chain.frequencyMat[currentIndex][nextIndex] == 0 {
+            return nil, fmt.Errorf("Unknown transition %v -> %q", pair.CurrentState, pair.NextState)
+        }
+        transitions = append(transitions, transition{currentIndex, nextIndex})
+    }
+    return transitions, nil
+}
+
+//Equal reports whether two chains hold the same transition counts, even if
+//their states were numbered differently
+func (chain *Chain) Equal(other *Chain) bool {
+    if chain.Order != other.Order {
+        return false
+    }
+    return reflect.DeepEqual(chain.counts(), other.counts())
+}
+
+//counts returns every transition count keyed by state rather than index
+func (chain *Chain) counts() map[string]map[string]int {
+    chain.lock.RLock()
+    defer chain.lock.RUnlock()
+    counts := make(map[string]map[string]int, len(chain.frequencyMat))
+    for current, arr := range chain.frequencyMat {
+        row := make(map[string]int, len(arr))
+        for next, count := range arr {
+            row[chain.statePool.lookup(next)] = count
+        }
+        counts[chain.statePool.lookup(current)] = row
+    }
+    return counts
+}
+
+//Merge adds every transition count in other to the chain, as though each
+//sequence other was trained on had been added weight times. Both chains
+//must have the same order.
+func (chain *Chain) Merge(other *Chain, weight int) error {
+    if chain.Order != other.Order {
+        return fmt.Errorf("Unable to merge a chain of order %d into one of order %d", other.Order, chain.Order)
+    }
+
+    //Take a copy first, so a chain can be merged into itself
+    counts := other.counts()
+    for current, row := range counts {
+        currentIndex := chain.statePool.add(current)
+        chain.lock.Lock()
+        arr := chain.frequencyMat[currentIndex]
+        if arr == nil {
+            arr = make(sparseArray)
+            chain.frequencyMat[currentIndex] = arr
+        }
+        for next, count := range row {
+            arr[chain.statePool.add(next)] += count * weight
+        }
+        chain.lock.Unlock()
+    }
+    return nil
+}
+
+//Scale multiplies every transition count by factor, rounding to the nearest
+//whole count. Transitions that round down to nothing are removed.
+func (chain *Chain) Scale(factor float64) {
+    chain.lock.Lock()
+    defer chain.lock.Unlock()
+    for _, arr := range chain.frequencyMat {
+        for next, count := range arr {
+            arr[next] = int(math.Round(float64(count) * factor))
+        }
+    }
+    chain.sweep(1)
+}
+
+//Prune removes every transition seen fewer than threshold times, along with
+//any state that's left unreachable, and returns how many transitions went
+func (chain *Chain) Prune(threshold int) int {
+    chain.lock.Lock()
+    defer chain.lock.Unlock()
+    return chain.sweep(threshold)
+}
+
+//sweep removes transitions with a count below threshold, then any states
+//that are no longer referenced. The caller must hold the chain lock.
+func (chain *Chain) sweep(threshold int) int {
+    removed := 0
+    referenced := make(map[int]bool)
+    for current, arr := range chain.frequencyMat {
+        for next, count := range arr {
+            if count < threshold {
+                delete(arr, next)
+                removed++
+            } else {
+                referenced[next] = true
+            }
+        }
+        if len(arr) == 0 {
+            delete(chain.frequencyMat, current)
+        } else {
+            referenced[current] = true
+        }
+    }
+
+    for _, index := range chain.statePool.indices() {
+        if !referenced[index] {
+            chain.statePool.remove(index)
+        }
+    }
+    return removed
+}
+
+//release forgets whichever of the given states are no longer referenced.
+//The caller must hold the chain lock.
+func (chain *Chain) release(states map[int]bool) {
+    for index := range states {
+        if _, ok := chain.frequencyMat[index]; ok {
+            delete(states, index)
+        }
+    }
+    for _, arr := range chain.frequencyMat {
+        if len(states) == 0 {
+            return
+        }
+        for next := range arr {
+            delete(states, next)
+        }
+    }
+    for index := range states {
+        chain.statePool.remove(index)
+    }
+}
+
+//TransitionProbability returns the transition probability between two states
+func (chain *Chain) TransitionProbability(next string, current NGram) (float64, error) {
+    if len(current) != chain.Order {
+        return 0, errors.New("N-gram length does not match chain order")
+    }
+    currentIndex, currentExists := chain.statePool.get(current.key())
+    nextIndex, nextExists := chain.statePool.get(next)
+    if !currentExists || !nextExists {
+        return 0, nil
+    }
+
+    chain.lock.RLock()
+    defer chain.lock.RUnlock()
+    arr := chain.frequencyMat[currentIndex]
+    sum := float64(arr.sum())
+    if sum == 0 {
+        return 0, nil
+    }
+    freq := float64(arr[nextIndex])
+    return freq / sum, nil
+}
+
+//Successors returns how many times each state has followed current
+func (chain *Chain) Successors(current NGram) (map[string]int, error) {
+    if len(current) != chain.Order {
+        return nil, errors.New("N-gram length does not match chain order")
+    }
+    successors := make(map[string]int)
+    currentIndex, currentExists := chain.statePool.get(current.key())
+    if !currentExists {
+        return successors, nil
+    }
+
+    chain.lock.RLock()
+    defer chain.lock.RUnlock()
+    for next, count := range chain.frequencyMat[currentIndex] {
+        successors[chain.statePool.lookup(next)] = count
+    }
+    return successors, nil
+}
+
+//Generate generates new text based on an initial seed of words
+func (chain *Chain) Generate(current NGram) (string, error) {
+    if len(current) != chain.Order {
+        return "", errors.New("N-gram length does not match chain order")
+    }
+    if current[len(current)-1] == EndToken {
+        // Dont generate anything after the end token
+        return "", nil
+    }
+    currentIndex, currentExists := chain.statePool.get(current.key())
+    if !currentExists {
+        return "", fmt.Errorf("Unknown ngram %v", current)
+    }
+
+    chain.lock.RLock()
+    defer chain.lock.RUnlock()
+    arr := chain.frequencyMat[currentIndex]
+    sum := arr.sum()
+    if sum == 0 {
+        return "", fmt.Errorf("Unknown ngram %v", current)
+    }
+    //Walk the candidates in a fixed order, so that seeding math/rand gives
+    //repeatable output
+    randN := rand.Intn(sum)
+    for _, i := range arr.keys() {
+        if randN < arr[i] {
+            return chain.statePool.lookup(i), nil
+        }
+        randN -= arr[i]
+    }
+    return "", nil
+}
+
+func decodeObject(decoder *json.Decoder, decodeValue func(key string) error) error {
+    token, err := decoder.Token()
+    if err != nil {
+        return err
+    }
+    if token == nil {
+        //null is as good as an empty object
+        return nil
+    }
+    if delim, ok := token.(json.Delim); !ok || delim != '{' {
+        return fmt.Errorf("Expected JSON object, got %v", token)
+    }
+
+    for decoder.More() {
+        token, err := decoder.Token()
+        if err != nil {
+            return err
+        }
+        if err := decodeValue(token.(string)); err != nil {
+            return err
+        }
+    }
+
+    //Consume the closing brace
+    _, err = decoder.Token()
+    return err
+}
+
+func decodeInt(decoder *json.Decoder) (int, error) {
+    var i int
+    err := decoder.Decode(&i)
+    return i, err
+}
+
+func init() {
+    rand.Seed(time.Now().UnixNano())
+}
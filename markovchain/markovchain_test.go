@@ -0,0 +1,441 @@
+package markovchain
+
+import (
+    "encoding/json"
+    "math/rand"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+        data     [][]string
+        expected string
+    }{
+        {"Empty chain", 2, [][]string{}, `{"int":2,"spool_map":{},"freq_mat":{}}`},
+        {"Trained once", 1, [][]string{{"Test"}}, `{"int":1,"spool_map":{"$":0,"Test":1,"^":2},"freq_mat":{"0":{"1":1},"1":{"2":1}}}`},
+        {"Trained on more data", 1, [][]string{{"test", "data"}, {"test", "data"}, {"test", "node"}}, `{"int":1,"spool_map":{"$":0,"^":3,"data":2,"node":4,"test":1},"freq_mat":{"0":{"1":3},"1":{"2":2,"4":1},"2":{"3":2},"4":{"3":1}}}`},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        chain := NewChain(table.order)
+        for _, data := range table.data {
+            chain.Add(data)
+        }
+
+        got, err := chain.MarshalJSON()
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if string(got) != table.expected {
+            t.Errorf("FAIL, expected: %s, got: %s", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestDecodeJSON(t *testing.T) {
+    tables := []struct {
+        testcase string
+        input    string
+        err      bool
+    }{
+        {"Empty chain", `{"int":2,"spool_map":{},"freq_mat":{}}`, false},
+        {"More complex chain", `{"int":1,"spool_map":{"$":0,"^":3,"data":2,"node":4,"test":1},"freq_mat":{"0":{"1":3},"1":{"2":2,"4":1},"2":{"3":2},"4":{"3":1}}}`, false},
+        {"Unknown field", `{"int":1,"extra":[1,{"a":2}],"spool_map":{"$":0,"^":2,"test":1},"freq_mat":{"0":{"1":1},"1":{"2":1}}}`, false},
+        {"Invalid json", `{{"int":2,"spool_map":{},"freq_mat":{}}`, true},
+        {"Invalid state index", `{"int":1,"spool_map":{},"freq_mat":{"a":{}}}`, true},
+        {"Not an object", `[1, 2]`, true},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        chain := new(Chain)
+        err := chain.Load(strings.NewReader(table.input))
+        if table.err {
+            if err == nil {
+                t.Errorf("FAIL, expected an error")
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+            continue
+        }
+
+        //Should be indistinguishable from a chain loaded by UnmarshalJSON
+        expected := new(Chain)
+        json.Unmarshal([]byte(table.input), expected)
+        if !reflect.DeepEqual(chain.statePool.intMap, expected.statePool.intMap) ||
+            !reflect.DeepEqual(chain.frequencyMat, expected.frequencyMat) ||
+            chain.Order != expected.Order {
+            t.Errorf("FAIL, expected: %#v, got: %#v", expected, chain)
+        } else {
+            t.Log("Passed")
+        }
+
+        chain.Add([]string{"test"})
+    }
+}
+
+func TestGenerate(t *testing.T) {
+    chain := NewChain(1)
+    chain.Add([]string{"test", "data"})
+    chain.Add([]string{"test", "node"})
+
+    tables := []struct {
+        testcase string
+        current  NGram
+        expected []string
+        err      bool
+    }{
+        {"Start", NGram{StartToken}, []string{"test"}, false},
+        {"Branch", NGram{"test"}, []string{"data", "node"}, false},
+        {"End", NGram{"data"}, []string{EndToken}, false},
+        {"After end", NGram{EndToken}, []string{""}, false},
+        {"Unknown ngram", NGram{"unknown"}, []string{""}, true},
+        {"Wrong order", NGram{"test", "data"}, []string{""}, true},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        got, err := chain.Generate(table.current)
+        if (err != nil) != table.err {
+            t.Errorf("FAIL, expected error: %v, got: %v", table.err, err)
+        }
+        found := false
+        for _, expected := range table.expected {
+            found = found || got == expected
+        }
+        if !found {
+            t.Errorf("FAIL, expected one of: %#v, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestGenerateSeeded(t *testing.T) {
+    chain := NewChain(1)
+    for _, word := range []string{"a", "b", "c", "d", "e", "f"} {
+        chain.Add([]string{"test", word})
+    }
+
+    generate := func() []string {
+        rand.Seed(42)
+        got := []string{}
+        for i := 0; i < 20; i++ {
+            next, _ := chain.Generate(NGram{"test"})
+            got = append(got, next)
+        }
+        return got
+    }
+
+    first := generate()
+    if second := generate(); !reflect.DeepEqual(first, second) {
+        t.Errorf("FAIL, same seed generated %#v then %#v", first, second)
+    }
+}
+
+func TestGenerateWeights(t *testing.T) {
+    chain := NewChain(1)
+    chain.Add([]string{"test", "data"})
+    for i := 0; i < 3; i++ {
+        chain.Add([]string{"test", "node"})
+    }
+
+    counts := make(map[string]int)
+    for i := 0; i < 4000; i++ {
+        next, _ := chain.Generate(NGram{"test"})
+        counts[next]++
+    }
+    //Each token should be picked in proportion to its count
+    if counts["data"] < 800 || counts["data"] > 1200 || counts["data"]+counts["node"] != 4000 {
+        t.Errorf("FAIL, expected data about 1000 times and node about 3000, got: %v", counts)
+    }
+}
+
+func TestScale(t *testing.T) {
+    tables := []struct {
+        testcase string
+        factor   float64
+        expected string
+    }{
+        {"Unchanged", 1, `{"int":1,"spool_map":{"$":0,"^":3,"data":2,"node":4,"test":1},"freq_mat":{"0":{"1":3},"1":{"2":2,"4":1},"2":{"3":2},"4":{"3":1}}}`},
+        {"Doubled", 2, `{"int":1,"spool_map":{"$":0,"^":3,"data":2,"node":4,"test":1},"freq_mat":{"0":{"1":6},"1":{"2":4,"4":2},"2":{"3":4},"4":{"3":2}}}`},
+        {"Rounded down to nothing", 0.4, `{"int":1,"spool_map":{"$":0,"^":3,"data":2,"test":1},"freq_mat":{"0":{"1":1},"1":{"2":1},"2":{"3":1}}}`},
+        {"Nothing left", 0, `{"int":1,"spool_map":{},"freq_mat":{}}`},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        chain := NewChain(1)
+        chain.Add([]string{"test", "data"})
+        chain.Add([]string{"test", "data"})
+        chain.Add([]string{"test", "node"})
+
+        chain.Scale(table.factor)
+        if got, _ := chain.MarshalJSON(); string(got) != table.expected {
+            t.Errorf("FAIL, expected: %s, got: %s", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestPrune(t *testing.T) {
+    tables := []struct {
+        testcase  string
+        threshold int
+        removed   int
+        expected  string
+    }{
+        {"Nothing pruned", 1, 0, `{"int":1,"spool_map":{"$":0,"^":3,"data":2,"node":4,"test":1},"freq_mat":{"0":{"1":3},"1":{"2":2,"4":1},"2":{"3":2},"4":{"3":1}}}`},
+        {"Rare branch pruned", 2, 2, `{"int":1,"spool_map":{"$":0,"^":3,"data":2,"test":1},"freq_mat":{"0":{"1":3},"1":{"2":2},"2":{"3":2}}}`},
+        {"Everything pruned", 4, 5, `{"int":1,"spool_map":{},"freq_mat":{}}`},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        chain := NewChain(1)
+        chain.Add([]string{"test", "data"})
+        chain.Add([]string{"test", "data"})
+        chain.Add([]string{"test", "node"})
+
+        if removed := chain.Prune(table.threshold); removed != table.removed {
+            t.Errorf("FAIL, expected %d removed, got: %d", table.removed, removed)
+        }
+        if got, _ := chain.MarshalJSON(); string(got) != table.expected {
+            t.Errorf("FAIL, expected: %s, got: %s", table.expected, got)
+        }
+
+        //New states mustn't clash with the ones left behind
+        chain.Add([]string{"test", "again"})
+        if next, _ := chain.Generate(NGram{"again"}); next != EndToken {
+            t.Errorf("FAIL, expected end token after new state, got: %#v", next)
+        }
+    }
+}
+
+func TestRemove(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+        base     [][]string
+        remove   []string
+    }{
+        {"Only sequence", 1, [][]string{}, []string{"test", "data"}},
+        {"Shared states", 1, [][]string{{"test", "data"}}, []string{"test", "node"}},
+        {"Same sequence twice", 1, [][]string{{"test", "data"}}, []string{"test", "data"}},
+        {"Repeated transitions", 1, [][]string{{"data"}}, []string{"test", " ", "test", " ", "test"}},
+        {"Order 2", 2, [][]string{{"test", "data"}}, []string{"test", "node", "data"}},
+        {"Order 3", 3, [][]string{{"a", "b", "c", "d"}}, []string{"a", "b", "x", "d"}},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        chain := NewChain(table.order)
+        for _, data := range table.base {
+            chain.Add(data)
+        }
+        expected, _ := chain.MarshalJSON()
+
+        chain.Add(table.remove)
+        if err := chain.Remove(table.remove, 1); err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if got, _ := chain.MarshalJSON(); string(got) != string(expected) {
+            t.Errorf("FAIL, expected: %s, got: %s", expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestRemoveUnknown(t *testing.T) {
+    chain := NewChain(1)
+    chain.Add([]string{"test", "data"})
+    want, _ := chain.MarshalJSON()
+
+    if chain.Contains([]string{"test", "node"}) {
+        t.Errorf("FAIL, chain.Contains() found a sequence that was never added")
+    }
+    if err := chain.Remove([]string{"test", "node"}, 1); err == nil {
+        t.Errorf("FAIL, expected an error removing a sequence that was never added")
+    }
+    if got, _ := chain.MarshalJSON(); string(got) != string(want) {
+        t.Errorf("FAIL, failed chain.Remove() changed chain to %s, want %s", got, want)
+    }
+}
+
+func TestEqual(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+        a        [][]string
+        b        [][]string
+        expected bool
+    }{
+        {"Empty", 1, [][]string{}, [][]string{}, true},
+        {"Same order", 1, [][]string{{"test"}, {"data"}}, [][]string{{"test"}, {"data"}}, true},
+        {"Different order", 1, [][]string{{"test"}, {"data"}}, [][]string{{"data"}, {"test"}}, true},
+        {"Different counts", 1, [][]string{{"test"}, {"test"}}, [][]string{{"test"}}, false},
+        {"Different chain order", 2, [][]string{}, [][]string{}, false},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        a := NewChain(table.order)
+        for _, data := range table.a {
+            a.Add(data)
+        }
+        b := NewChain(1)
+        for _, data := range table.b {
+            b.Add(data)
+        }
+        if got := a.Equal(b); got != table.expected {
+            t.Errorf("FAIL, expected: %v, got: %v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestMerge(t *testing.T) {
+    tables := []struct {
+        testcase string
+        order    int
+        a        [][]string
+        b        [][]string
+        weight   int
+        expected [][]string
+        err      bool
+    }{
+        {"Into empty", 1, [][]string{}, [][]string{{"test", "data"}}, 1, [][]string{{"test", "data"}}, false},
+        {"Overlapping", 1, [][]string{{"test", "data"}}, [][]string{{"test", "data"}, {"data"}}, 1, [][]string{{"test", "data"}, {"test", "data"}, {"data"}}, false},
+        {"Weighted", 2, [][]string{{"test"}}, [][]string{{"data"}}, 3, [][]string{{"test"}, {"data"}, {"data"}, {"data"}}, false},
+        {"Different orders", 2, [][]string{}, [][]string{}, 1, [][]string{}, true},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        a := NewChain(table.order)
+        for _, data := range table.a {
+            a.Add(data)
+        }
+        bOrder := table.order
+        if table.err {
+            bOrder = 1
+        }
+        b := NewChain(bOrder)
+        for _, data := range table.b {
+            b.Add(data)
+        }
+        expected := NewChain(table.order)
+        for _, data := range table.expected {
+            expected.Add(data)
+        }
+
+        err := a.Merge(b, table.weight)
+        if (err != nil) != table.err {
+            t.Errorf("FAIL, expected error: %v, got: %v", table.err, err)
+        } else if !a.Equal(expected) {
+            t.Errorf("FAIL, expected: %v, got: %v", expected.counts(), a.counts())
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestMergeSelf(t *testing.T) {
+    tables := []struct {
+        testcase string
+        weight   int
+        expected int
+    }{
+        {"Unweighted", 1, 2},
+        {"Weighted", 2, 3},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        chain := NewChain(1)
+        chain.Add([]string{"test", "data"})
+        expected := NewChain(1)
+        expected.AddWeighted([]string{"test", "data"}, table.expected)
+
+        if err := chain.Merge(chain, table.weight); err != nil {
+            t.Errorf("FAIL, unexpected error: %v", err)
+        } else if !chain.Equal(expected) {
+            t.Errorf("FAIL, expected: %v, got: %v", expected.counts(), chain.counts())
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestSuccessors(t *testing.T) {
+    chain := NewChain(1)
+    chain.Add([]string{"test", "data"})
+    chain.Add([]string{"test", "test"})
+
+    tables := []struct {
+        testcase string
+        current  NGram
+        expected map[string]int
+        err      bool
+    }{
+        {"Known", NGram{"test"}, map[string]int{"data": 1, "test": 1, EndToken: 1}, false},
+        {"Start", NGram{StartToken}, map[string]int{"test": 2}, false},
+        {"Unknown", NGram{"unknown"}, map[string]int{}, false},
+        {"Wrong order", NGram{"test", "data"}, nil, true},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        got, err := chain.Successors(table.current)
+        if (err != nil) != table.err {
+            t.Errorf("FAIL, expected error: %v, got: %v", table.err, err)
+        } else if !reflect.DeepEqual(got, table.expected) {
+            t.Errorf("FAIL, expected: %v, got: %v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestStats(t *testing.T) {
+    chain := NewChain(1)
+    chain.Add([]string{"a", "b"})
+    chain.Add([]string{"a", "c"})
+    chain.Add([]string{"a", "b"})
+
+    got := chain.Stats(2)
+    if got.MemoryBytes <= 0 {
+        t.Errorf("FAIL, expected a memory estimate, got: %v", got.MemoryBytes)
+    }
+    got.MemoryBytes = 0
+    expected := Stats{
+        Order:         1,
+        Vocabulary:    3,
+        NGrams:        4,
+        Transitions:   5,
+        TotalCount:    9,
+        TopTokens:     []Count{{"a", 3}, {"b", 2}},
+        TopNGrams:     []Count{{StartToken, 3}, {"a", 3}},
+        Branching:     map[int]int{1: 3, 2: 1},
+        MeanBranching: 1.25,
+    }
+    if !reflect.DeepEqual(got, expected) {
+        t.Errorf("FAIL, expected: %#v, got: %#v", expected, got)
+    }
+
+    empty := NewChain(2).Stats(DefaultTop)
+    if empty.NGrams != 0 || empty.MeanBranching != 0 || len(empty.TopTokens) != 0 {
+        t.Errorf("FAIL, expected empty stats, got: %#v", empty)
+    }
+}
+
+func TestTokens(t *testing.T) {
+    chain := NewChain(2)
+    chain.Add([]string{"b", "a"})
+    chain.Add([]string{"a", "c"})
+
+    expected := []string{"a", "b", "c"}
+    if got := chain.Tokens(); !reflect.DeepEqual(got, expected) {
+        t.Errorf("FAIL, expected: %#v, got: %#v", expected, got)
+    }
+}
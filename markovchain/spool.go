@@ -0,0 +1,92 @@
+package markovchain
+
+import (
+    "sort"
+    "sync"
+)
+
+//spool interns every state the chain has seen, so the frequency matrix can
+//refer to them by index
+type spool struct {
+    stringMap map[string]int
+    intMap    map[int]string
+    next      int
+    sync.RWMutex
+}
+
+func newSpool(stringMap map[string]int) *spool {
+    intMap := make(map[int]string, len(stringMap))
+    next := 0
+    for k, v := range stringMap {
+        intMap[v] = k
+        if v >= next {
+            next = v + 1
+        }
+    }
+    return &spool{
+        stringMap: stringMap,
+        intMap:    intMap,
+        next:      next,
+    }
+}
+
+func (s *spool) add(str string) int {
+    s.RLock()
+    index, ok := s.stringMap[str]
+    s.RUnlock()
+    if ok {
+        return index
+    }
+    s.Lock()
+    defer s.Unlock()
+    index, ok = s.stringMap[str]
+    if ok {
+        return index
+    }
+    index = s.next
+    s.next++
+    s.stringMap[str] = index
+    s.intMap[index] = str
+    return index
+}
+
+//remove forgets a state. Indices are only reused once every index above
+//them is free, so that removing the most recently added states puts the
+//spool back exactly as it was.
+func (s *spool) remove(index int) {
+    s.Lock()
+    defer s.Unlock()
+    delete(s.stringMap, s.intMap[index])
+    delete(s.intMap, index)
+    for s.next > 0 {
+        if _, ok := s.intMap[s.next-1]; ok {
+            break
+        }
+        s.next--
+    }
+}
+
+func (s *spool) get(str string) (int, bool) {
+    s.RLock()
+    defer s.RUnlock()
+    index, ok := s.stringMap[str]
+    return index, ok
+}
+
+func (s *spool) lookup(index int) string {
+    s.RLock()
+    defer s.RUnlock()
+    return s.intMap[index]
+}
+
+//indices returns every index in use, highest first
+func (s *spool) indices() []int {
+    s.RLock()
+    defer s.RUnlock()
+    indices := make([]int, 0, len(s.intMap))
+    for index := range s.intMap {
+        indices = append(indices, index)
+    }
+    sort.Sort(sort.Reverse(sort.IntSlice(indices)))
+    return indices
+}
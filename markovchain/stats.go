@@ -0,0 +1,129 @@
+package markovchain
+
+import (
+    "sort"
+)
+
+//DefaultTop is how many of the most frequent tokens and n-grams brains
+//include in their stats
+const DefaultTop = 10
+
+//Rough sizes in bytes of the chain's parts, for estimating its memory use:
+//a map entry and the overhead of a map of its own
+const (
+    mapEntrySize = 48
+    mapSize      = 48
+)
+
+//Count is how many times a state was seen
+type Count struct {
+    //State is a token, or for n-grams, its tokens joined by underscores
+    State string
+    Count int
+}
+
+//Stats describes what a chain has learned
+type Stats struct {
+    Order int
+    //Vocabulary is how many distinct tokens the chain can generate
+    Vocabulary int
+    //NGrams is how many distinct n-grams have been followed by something
+    NGrams int
+    //Transitions is how many distinct n-gram to token transitions there
+    //are, and TotalCount the sum of their counts
+    Transitions int
+    TotalCount  int
+    //TopTokens and TopNGrams are the most frequent tokens and n-grams, most
+    //frequent first
+    TopTokens []Count
+    TopNGrams []Count
+    //Branching maps the number of different tokens that have followed an
+    //n-gram to how many n-grams have that many, and MeanBranching is the
+    //average
+    Branching     map[int]int
+    MeanBranching float64
+    //MemoryBytes is a rough estimate of the chain's size in memory
+    MemoryBytes int
+}
+
+//Stats describes the chain, including the top most frequent tokens and
+//n-grams. Start and end tokens aren't counted as tokens.
+func (chain *Chain) Stats(top int) Stats {
+    chain.lock.RLock()
+    defer chain.lock.RUnlock()
+
+    stats := Stats{
+        Order:     chain.Order,
+        NGrams:    len(chain.frequencyMat),
+        Branching: make(map[int]int),
+    }
+    tokens := make(map[string]int)
+    ngrams := make(map[string]int)
+    for current, arr := range chain.frequencyMat {
+        stats.Transitions += len(arr)
+        stats.Branching[len(arr)]++
+        stats.MemoryBytes += mapEntrySize + mapSize + len(arr)*mapEntrySize
+        for next, count := range arr {
+            stats.TotalCount += count
+            ngrams[chain.statePool.lookup(current)] += count
+            if token := chain.statePool.lookup(next); token != StartToken && token != EndToken {
+                tokens[token] += count
+            }
+        }
+    }
+    stats.Vocabulary = len(tokens)
+    if stats.NGrams > 0 {
+        stats.MeanBranching = float64(stats.Transitions) / float64(stats.NGrams)
+    }
+    stats.TopTokens = topCounts(tokens, top)
+    stats.TopNGrams = topCounts(ngrams, top)
+
+    //Each state is stored twice in the spool, once in each direction
+    chain.statePool.RLock()
+    for state := range chain.statePool.stringMap {
+        stats.MemoryBytes += 2 * (mapEntrySize + len(state))
+    }
+    chain.statePool.RUnlock()
+    return stats
+}
+
+//Tokens returns every token the chain can generate, in alphabetical order.
+//Start and end tokens aren't included.
+func (chain *Chain) Tokens() []string {
+    chain.lock.RLock()
+    defer chain.lock.RUnlock()
+
+    seen := make(map[int]bool)
+    for _, arr := range chain.frequencyMat {
+        for next := range arr {
+            seen[next] = true
+        }
+    }
+    tokens := make([]string, 0, len(seen))
+    for next := range seen {
+        if token := chain.statePool.lookup(next); token != StartToken && token != EndToken {
+            tokens = append(tokens, token)
+        }
+    }
+    sort.Strings(tokens)
+    return tokens
+}
+
+//topCounts returns the top most frequent states in counts, breaking ties
+//alphabetically
+func topCounts(counts map[string]int, top int) []Count {
+    sorted := make([]Count, 0, len(counts))
+    for state, count := range counts {
+        sorted = append(sorted, Count{state, count})
+    }
+    sort.Slice(sorted, func(i, j int) bool {
+        if sorted[i].Count != sorted[j].Count {
+            return sorted[i].Count > sorted[j].Count
+        }
+        return sorted[i].State < sorted[j].State
+    })
+    if top >= 0 && len(sorted) > top {
+        sorted = sorted[:top]
+    }
+    return sorted
+}
@@ -0,0 +1,110 @@
+package brain
+
+import (
+    "sync"
+    "time"
+)
+
+//Memory is a short-term memory of the last few messages in each
+//conversation, so that replies can stay on topic. Nothing in it is ever
+//trained into a brain, and conversations are forgotten once they've been
+//idle for a while.
+type Memory struct {
+    size          int
+    ttl           time.Duration
+    conversations map[string]*conversation
+    lastExpired   time.Time
+    now           func() time.Time
+    lock          sync.Mutex
+}
+
+type conversation struct {
+    messages [][]string
+    last     time.Time
+}
+
+//NewMemory remembers the last size messages of each conversation, until it
+//has been idle for ttl. A ttl of 0 or less means conversations never expire.
+func NewMemory(size int, ttl time.Duration) *Memory {
+    return &Memory{
+        size:          size,
+        ttl:           ttl,
+        conversations: make(map[string]*conversation),
+        now:           time.Now,
+    }
+}
+
+//Remember adds a message to the conversation in chatID
+func (memory *Memory) Remember(chatID string, message string) {
+    memory.lock.Lock()
+    defer memory.lock.Unlock()
+
+    now := memory.now()
+    //Sweeping every conversation on every message would be wasteful
+    if memory.ttl > 0 && now.Sub(memory.lastExpired) >= memory.ttl {
+        memory.expire(now)
+    }
+
+    conv := memory.conversations[chatID]
+    if conv == nil || memory.idle(conv, now) {
+        conv = new(conversation)
+        memory.conversations[chatID] = conv
+    }
+    conv.messages = append(conv.messages, ProcessString(message))
+    if len(conv.messages) > memory.size {
+        conv.messages = conv.messages[len(conv.messages)-memory.size:]
+    }
+    conv.last = now
+}
+
+//Context returns the processed tokens of every message remembered for
+//chatID, oldest first
+func (memory *Memory) Context(chatID string) []string {
+    memory.lock.Lock()
+    defer memory.lock.Unlock()
+
+    context := []string{}
+    conv := memory.conversations[chatID]
+    if conv == nil {
+        return context
+    }
+    if memory.idle(conv, memory.now()) {
+        delete(memory.conversations, chatID)
+        return context
+    }
+    for _, message := range conv.messages {
+        context = append(context, message...)
+    }
+    return context
+}
+
+//Forget forgets the conversation in chatID
+func (memory *Memory) Forget(chatID string) {
+    memory.lock.Lock()
+    defer memory.lock.Unlock()
+    delete(memory.conversations, chatID)
+}
+
+//Expire forgets every conversation that's been idle for longer than the
+//memory's ttl, returning how many there were
+func (memory *Memory) Expire() int {
+    memory.lock.Lock()
+    defer memory.lock.Unlock()
+    return memory.expire(memory.now())
+}
+
+func (memory *Memory) expire(now time.Time) int {
+    expired := 0
+    for chatID, conv := range memory.conversations {
+        if memory.idle(conv, now) {
+            delete(memory.conversations, chatID)
+            expired++
+        }
+    }
+    memory.lastExpired = now
+    return expired
+}
+
+func (memory *Memory) idle(conv *conversation, now time.Time) bool {
+    return memory.ttl > 0 && now.Sub(conv.last) > memory.ttl
+}
@@ -0,0 +1,64 @@
+package brain
+
+import (
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestMemory(t *testing.T) {
+    start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+    tables := []struct {
+        testcase string
+        size     int
+        ttl      time.Duration
+        elapsed  time.Duration
+        expected []string
+    }{
+        {"Remembered", 2, time.Hour, time.Minute, []string{"test", "data"}},
+        {"Only the last few", 1, time.Hour, time.Minute, []string{"data"}},
+        {"Expired", 2, time.Hour, 2 * time.Hour, []string{}},
+        {"Never expires", 2, 0, 1000 * time.Hour, []string{"test", "data"}},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        now := start
+        memory := NewMemory(table.size, table.ttl)
+        memory.now = func() time.Time { return now }
+
+        memory.Remember("chat", "test")
+        memory.Remember("chat", "data")
+        memory.Remember("other", "other")
+        now = now.Add(table.elapsed)
+
+        if got := memory.Context("chat"); !reflect.DeepEqual(got, table.expected) {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestMemoryExpire(t *testing.T) {
+    now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+    memory := NewMemory(2, time.Hour)
+    memory.now = func() time.Time { return now }
+
+    memory.Remember("old", "test")
+    now = now.Add(30 * time.Minute)
+    memory.Remember("new", "data")
+    now = now.Add(45 * time.Minute)
+
+    if expired := memory.Expire(); expired != 1 {
+        t.Errorf("FAIL, expected 1 conversation to expire, got: %d", expired)
+    }
+    if got := memory.Context("new"); !reflect.DeepEqual(got, []string{"data"}) {
+        t.Errorf("FAIL, expected the newer conversation to be remembered, got: %#v", got)
+    }
+
+    memory.Forget("new")
+    if got := memory.Context("new"); len(got) != 0 {
+        t.Errorf("FAIL, expected the conversation to be forgotten, got: %#v", got)
+    }
+}
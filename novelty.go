@@ -0,0 +1,156 @@
+package brain
+
+import (
+    "encoding/json"
+    "errors"
+    "hash/fnv"
+    "strings"
+    "sync"
+)
+
+//ErrNotNovel is returned when every reply a brain generated repeated too much
+//of a training message
+var ErrNotNovel = errors.New("Unable to generate a novel reply")
+
+//NoveltyGuard indexes the messages a brain was trained on, so that replies
+//which copy too much of any one of them can be caught. Messages are indexed
+//as hashed shingles: every run of MaxOverlap+1 consecutive words, ignoring
+//case, whitespace and punctuation. A reply sharing any shingle with the index
+//repeats more than MaxOverlap words of some message verbatim.
+type NoveltyGuard struct {
+    maxOverlap int
+    retries    int
+    shingles   map[uint64]int
+    lock       sync.RWMutex
+}
+
+type noveltyGuardJSON struct {
+    MaxOverlap int
+    Retries    int
+    Shingles   map[uint64]int
+}
+
+//NewNoveltyGuard rejects replies that repeat more than maxOverlap words of a
+//training message in a row, generating up to retries more replies before
+//giving up. A maxOverlap under 1 is treated as 1.
+func NewNoveltyGuard(maxOverlap int, retries int) *NoveltyGuard {
+    if maxOverlap < 1 {
+        maxOverlap = 1
+    }
+    return &NoveltyGuard{
+        maxOverlap: maxOverlap,
+        retries:    retries,
+        shingles:   make(map[uint64]int),
+    }
+}
+
+func (guard *NoveltyGuard) MarshalJSON() ([]byte, error) {
+    guard.lock.RLock()
+    defer guard.lock.RUnlock()
+    return json.Marshal(noveltyGuardJSON{guard.maxOverlap, guard.retries, guard.shingles})
+}
+
+func (guard *NoveltyGuard) UnmarshalJSON(b []byte) error {
+    var obj noveltyGuardJSON
+    if err := json.Unmarshal(b, &obj); err != nil {
+        return err
+    }
+
+    guard.lock.Lock()
+    defer guard.lock.Unlock()
+    guard.maxOverlap = obj.MaxOverlap
+    if guard.maxOverlap < 1 {
+        guard.maxOverlap = 1
+    }
+    guard.retries = obj.Retries
+    guard.shingles = obj.Shingles
+    if guard.shingles == nil {
+        guard.shingles = make(map[uint64]int)
+    }
+    return nil
+}
+
+//MaxOverlap is the most words in a row a reply can share with a message
+func (guard *NoveltyGuard) MaxOverlap() int {
+    return guard.maxOverlap
+}
+
+//Retries is how many more replies to generate when one isn't novel
+func (guard *NoveltyGuard) Retries() int {
+    return guard.retries
+}
+
+//Add indexes a processed training message
+func (guard *NoveltyGuard) Add(tokens []string) {
+    hashes := guard.hash(tokens)
+    guard.lock.Lock()
+    defer guard.lock.Unlock()
+    for _, hash := range hashes {
+        guard.shingles[hash]++
+    }
+}
+
+//Remove takes a message indexed with Add out of the index again
+func (guard *NoveltyGuard) Remove(tokens []string) {
+    hashes := guard.hash(tokens)
+    guard.lock.Lock()
+    defer guard.lock.Unlock()
+    for _, hash := range hashes {
+        if guard.shingles[hash] <= 1 {
+            delete(guard.shingles, hash)
+        } else {
+            guard.shingles[hash]--
+        }
+    }
+}
+
+//Merge adds everything indexed in other. Both guards should have the same
+//MaxOverlap, or other's shingles will never match anything.
+func (guard *NoveltyGuard) Merge(other *NoveltyGuard) {
+    if other == guard {
+        return
+    }
+    other.lock.RLock()
+    defer other.lock.RUnlock()
+    guard.lock.Lock()
+    defer guard.lock.Unlock()
+    for hash, count := range other.shingles {
+        guard.shingles[hash] += count
+    }
+}
+
+//Novel reports whether a processed reply repeats no more than MaxOverlap
+//words in a row of any message in the index
+func (guard *NoveltyGuard) Novel(tokens []string) bool {
+    hashes := guard.hash(tokens)
+    guard.lock.RLock()
+    defer guard.lock.RUnlock()
+    for _, hash := range hashes {
+        if guard.shingles[hash] > 0 {
+            return false
+        }
+    }
+    return true
+}
+
+//hash hashes every shingle in tokens
+func (guard *NoveltyGuard) hash(tokens []string) []uint64 {
+    words := []string{}
+    for _, token := range tokens {
+        if isWord(token) {
+            words = append(words, strings.ToLower(token))
+        }
+    }
+
+    size := guard.maxOverlap + 1
+    hashes := []uint64{}
+    for i := 0; i+size <= len(words); i++ {
+        h := fnv.New64a()
+        for _, word := range words[i : i+size] {
+            h.Write([]byte(word))
+            h.Write([]byte{0})
+        }
+        hashes = append(hashes, h.Sum64())
+    }
+    return hashes
+}
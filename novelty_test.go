@@ -0,0 +1,70 @@
+package brain
+
+import (
+    "encoding/json"
+    "testing"
+)
+
+func TestNoveltyGuard(t *testing.T) {
+    tables := []struct {
+        testcase   string
+        maxOverlap int
+        reply      string
+        expected   bool
+    }{
+        {"Verbatim", 3, "The quick brown fox jumps over the lazy dog", false},
+        {"Different case and punctuation", 3, "the QUICK, brown... fox!", false},
+        {"Short overlap", 3, "A quick brown cat", true},
+        {"Exactly the maximum", 3, "The quick brown cat", true},
+        {"Across messages", 3, "Lazy dog jumps high", true},
+        {"Shorter than a shingle", 3, "Quick fox", true},
+        {"Lower maximum", 1, "A brown fox", false},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        guard := NewNoveltyGuard(table.maxOverlap, 5)
+        guard.Add(ProcessString("The quick brown fox jumps over the lazy dog"))
+        guard.Add(ProcessString("Dogs can jump high"))
+
+        //Should survive a save and load
+        b, _ := json.Marshal(guard)
+        guard = new(NoveltyGuard)
+        if err := json.Unmarshal(b, guard); err != nil {
+            t.Fatalf("FAIL, unable to unmarshal guard: %v", err)
+        }
+
+        if got := guard.Novel(ProcessString(table.reply)); got != table.expected {
+            t.Errorf("FAIL, expected: %v, got: %v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestNoveltyGuardRemove(t *testing.T) {
+    guard := NewNoveltyGuard(2, 5)
+    guard.Add(ProcessString("test data test"))
+    guard.Add(ProcessString("test data test"))
+    reply := ProcessString("Test data test")
+
+    guard.Remove(ProcessString("test data test"))
+    if guard.Novel(reply) {
+        t.Errorf("FAIL, expected a message trained twice to still be indexed")
+    }
+    guard.Remove(ProcessString("test data test"))
+    if !guard.Novel(reply) {
+        t.Errorf("FAIL, expected the message to be removed from the index")
+    }
+}
+
+func TestNoveltyGuardMerge(t *testing.T) {
+    guard := NewNoveltyGuard(2, 5)
+    other := NewNoveltyGuard(2, 5)
+    other.Add(ProcessString("test data test"))
+
+    guard.Merge(other)
+    if guard.Novel(ProcessString("test data test")) {
+        t.Errorf("FAIL, expected merged messages to be indexed")
+    }
+}
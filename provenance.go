@@ -0,0 +1,137 @@
+package brain
+
+import (
+    "encoding/json"
+    "reflect"
+    "sort"
+    "sync"
+    "time"
+)
+
+//Meta describes where a training message came from
+type Meta struct {
+    AuthorID string    `json:",omitempty"`
+    ChatID   string    `json:",omitempty"`
+    Time     time.Time
+}
+
+//MetaTrainer is implemented by brains that can record where their training
+//data came from
+type MetaTrainer interface {
+    TrainWithMeta(data string, meta Meta) error
+}
+
+//MessageTrainer is implemented by brains that report how many tokens each
+//message was trained as, after redaction and sentence splitting. meta may be
+//nil.
+type MessageTrainer interface {
+    TrainMessage(data string, meta *Meta) (int, error)
+}
+
+//Record is a single message a brain was trained on, as kept by Provenance
+type Record struct {
+    Tokens []string
+    ChatID string    `json:",omitempty"`
+    Time   time.Time
+}
+
+//Provenance records which author taught a brain which messages, so that
+//everything a given author has said can be untrained again
+type Provenance struct {
+    authors map[string][]Record
+    lock    sync.RWMutex
+}
+
+func NewProvenance() *Provenance {
+    return &Provenance{authors: make(map[string][]Record)}
+}
+
+func (provenance *Provenance) MarshalJSON() ([]byte, error) {
+    provenance.lock.RLock()
+    defer provenance.lock.RUnlock()
+    return json.Marshal(provenance.authors)
+}
+
+func (provenance *Provenance) UnmarshalJSON(b []byte) error {
+    provenance.lock.Lock()
+    defer provenance.lock.Unlock()
+    provenance.authors = make(map[string][]Record)
+    return json.Unmarshal(b, &provenance.authors)
+}
+
+//Add records that tokens were trained from a message described by meta.
+//Messages without an author aren't recorded, as they could never be erased.
+func (provenance *Provenance) Add(tokens []string, meta Meta) {
+    if meta.AuthorID == "" {
+        return
+    }
+
+    provenance.lock.Lock()
+    defer provenance.lock.Unlock()
+    provenance.authors[meta.AuthorID] = append(provenance.authors[meta.AuthorID], Record{tokens, meta.ChatID, meta.Time})
+}
+
+//Merge adds every record in other
+func (provenance *Provenance) Merge(other *Provenance) {
+    if other == provenance {
+        return
+    }
+    other.lock.RLock()
+    defer other.lock.RUnlock()
+    provenance.lock.Lock()
+    defer provenance.lock.Unlock()
+    for author, records := range other.authors {
+        provenance.authors[author] = append(provenance.authors[author], records...)
+    }
+}
+
+//Forget removes the record of one message with exactly these tokens. If
+//authorID is empty, a message from any author will do: the most recent one,
+//or if several were sent at once, the one from the first author in ID order,
+//so that replaying a journal always forgets the same record.
+func (provenance *Provenance) Forget(tokens []string, authorID string) bool {
+    provenance.lock.Lock()
+    defer provenance.lock.Unlock()
+
+    authors := []string{authorID}
+    if authorID == "" {
+        authors = make([]string, 0, len(provenance.authors))
+        for author := range provenance.authors {
+            authors = append(authors, author)
+        }
+        sort.Strings(authors)
+    }
+
+    found, index := "", -1
+    for _, author := range authors {
+        records := provenance.authors[author]
+        //Within an author, the last matching record is the most recent
+        for i := len(records) - 1; i >= 0; i-- {
+            if !reflect.DeepEqual(records[i].Tokens, tokens) {
+                continue
+            }
+            if index < 0 || records[i].Time.After(provenance.authors[found][index].Time) {
+                found, index = author, i
+            }
+            break
+        }
+    }
+    if index < 0 {
+        return false
+    }
+
+    records := append(provenance.authors[found][:index], provenance.authors[found][index+1:]...)
+    if len(records) == 0 {
+        delete(provenance.authors, found)
+    } else {
+        provenance.authors[found] = records
+    }
+    return true
+}
+
+//Records returns a copy of every message recorded for authorID
+func (provenance *Provenance) Records(authorID string) []Record {
+    provenance.lock.RLock()
+    defer provenance.lock.RUnlock()
+    return append([]Record{}, provenance.authors[authorID]...)
+}
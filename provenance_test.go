@@ -0,0 +1,68 @@
+package brain
+
+import (
+    "encoding/json"
+    "reflect"
+    "testing"
+    "time"
+)
+
+func TestProvenance(t *testing.T) {
+    when := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+    tables := []struct {
+        testcase string
+        forget   []string
+        authorID string
+        found    bool
+        alice    int
+        bob      int
+    }{
+        {"Forget the latest from any author", []string{"test"}, "", true, 2, 0},
+        {"Forget from the first of authors at once", []string{"data"}, "", true, 1, 1},
+        {"Forget from the right author", []string{"test"}, "bob", true, 2, 0},
+        {"Forget from the wrong author", []string{"data"}, "bob", false, 2, 1},
+        {"Forget unknown message", []string{"unknown"}, "", false, 2, 1},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        provenance := NewProvenance()
+        provenance.Add([]string{"test"}, Meta{AuthorID: "alice", Time: when})
+        provenance.Add([]string{"data"}, Meta{AuthorID: "alice", ChatID: "chat", Time: when})
+        provenance.Add([]string{"test"}, Meta{AuthorID: "bob", Time: when.Add(time.Hour)})
+        provenance.Add([]string{"data"}, Meta{AuthorID: "carol", Time: when})
+        provenance.Add([]string{"anonymous"}, Meta{Time: when})
+
+        //Should survive a save and load
+        b, _ := json.Marshal(provenance)
+        provenance = new(Provenance)
+        if err := json.Unmarshal(b, provenance); err != nil {
+            t.Fatalf("FAIL, unable to unmarshal provenance: %v", err)
+        }
+
+        if found := provenance.Forget(table.forget, table.authorID); found != table.found {
+            t.Errorf("FAIL, expected found: %v, got: %v", table.found, found)
+        }
+        alice := provenance.Records("alice")
+        bob := provenance.Records("bob")
+        if len(alice) != table.alice || len(bob) != table.bob {
+            t.Errorf("FAIL, expected %d and %d records, got: %#v and %#v", table.alice, table.bob, alice, bob)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestProvenanceRecords(t *testing.T) {
+    when := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+    provenance := NewProvenance()
+    provenance.Add([]string{"test"}, Meta{AuthorID: "alice", ChatID: "chat", Time: when})
+
+    expected := []Record{{[]string{"test"}, "chat", when}}
+    if got := provenance.Records("alice"); !reflect.DeepEqual(got, expected) {
+        t.Errorf("FAIL, expected: %#v, got: %#v", expected, got)
+    }
+    if got := provenance.Records("nobody"); len(got) != 0 {
+        t.Errorf("FAIL, expected no records, got: %#v", got)
+    }
+}
@@ -0,0 +1,198 @@
+package brain
+
+import (
+    "math/big"
+    "net"
+    "net/url"
+    "regexp"
+    "strconv"
+    "strings"
+)
+
+//Redaction is a kind of personal information a Redactor can remove
+type Redaction string
+
+const (
+    RedactEmail Redaction = "email"
+    RedactPhone Redaction = "phone"
+    RedactCard  Redaction = "card"
+    RedactIBAN  Redaction = "iban"
+    RedactIP    Redaction = "ip"
+    //RedactURL only removes URLs with credentials or tokens in them
+    RedactURL   Redaction = "url"
+)
+
+//Redactions is every kind of personal information, in the order they're
+//redacted. Earlier ones would otherwise be mistaken for later ones, such as
+//an IP address for a phone number.
+var Redactions = []Redaction{RedactURL, RedactEmail, RedactIBAN, RedactCard, RedactIP, RedactPhone}
+
+var (
+    emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+    phonePattern = regexp.MustCompile(`\+?\(?\d[\d ().-]{5,}\d`)
+    datePattern  = regexp.MustCompile(`^(?:\d{4}[-/.]\d{1,2}[-/.]\d{1,2}|\d{1,2}[-/.]\d{1,2}[-/.]\d{2,4})`)
+    cardPattern  = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+    ibanPattern  = regexp.MustCompile(`(?i)\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`)
+    ipv4Pattern  = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+    ipv6Pattern  = regexp.MustCompile(`(?i)\b[0-9a-f]*:[0-9a-f:]*:[0-9a-f]*\b`)
+    urlPattern   = regexp.MustCompile(`(?i)\b(?:https?|ftp)://[^\s<>"]+`)
+    secretParam  = regexp.MustCompile(`(?i)token|key|secret|pass|auth|sig|session|code|sid`)
+    nonDigits    = regexp.MustCompile(`\D`)
+)
+
+//Redactor replaces personal information in messages with placeholders like
+//<email>, so that a brain never learns it and can never repeat it
+type Redactor struct {
+    //Placeholders maps each kind of information to redact to what it's
+    //replaced with. Placeholders should be a lower case word in angle
+    //brackets, so that ProcessRedacted keeps them whole.
+    Placeholders map[Redaction]string
+}
+
+//NewRedactor redacts the given kinds of information, or every kind if none
+//are given
+func NewRedactor(redactions ...Redaction) *Redactor {
+    if len(redactions) == 0 {
+        redactions = Redactions
+    }
+    redactor := &Redactor{Placeholders: make(map[Redaction]string)}
+    for _, redaction := range redactions {
+        redactor.Placeholders[redaction] = "<" + string(redaction) + ">"
+    }
+    return redactor
+}
+
+//Redact replaces everything the redactor is configured for in text
+func (redactor *Redactor) Redact(text string) string {
+    for _, redaction := range Redactions {
+        replacement, ok := redactor.Placeholders[redaction]
+        if !ok {
+            continue
+        }
+        switch redaction {
+        case RedactEmail:
+            text = emailPattern.ReplaceAllLiteralString(text, replacement)
+        case RedactPhone:
+            text = replaceValid(phonePattern, text, replacement, isPhone)
+        case RedactCard:
+            text = replaceValid(cardPattern, text, replacement, isCard)
+        case RedactIBAN:
+            text = replaceIBANs(text, replacement)
+        case RedactIP:
+            text = replaceValid(ipv4Pattern, text, replacement, isIP)
+            text = replaceValid(ipv6Pattern, text, replacement, isIP)
+        case RedactURL:
+            text = replaceValid(urlPattern, text, replacement, hasSecrets)
+        }
+    }
+    return text
+}
+
+//replaceValid replaces matches of pattern in text, but only those valid
+//says are really what they look like
+func replaceValid(pattern *regexp.Regexp, text string, replacement string, valid func(string) bool) string {
+    return pattern.ReplaceAllStringFunc(text, func(match string) string {
+        if valid(match) {
+            return replacement
+        }
+        return match
+    })
+}
+
+//replaceIBANs replaces IBANs in text. The pattern can run on into the next
+//word, so failing matches are cut back a group at a time until they're valid.
+func replaceIBANs(text string, replacement string) string {
+    return ibanPattern.ReplaceAllStringFunc(text, func(match string) string {
+        candidate := match
+        for len(strings.Replace(candidate, " ", "", -1)) >= 15 {
+            if isIBAN(candidate) {
+                return replacement + match[len(candidate):]
+            }
+            space := strings.LastIndex(candidate, " ")
+            if space < 0 {
+                break
+            }
+            candidate = candidate[:space]
+        }
+        return match
+    })
+}
+
+func isPhone(match string) bool {
+    if datePattern.MatchString(match) {
+        return false
+    }
+    digits := len(nonDigits.ReplaceAllString(match, ""))
+    if strings.HasPrefix(match, "+") || strings.HasPrefix(match, "(") {
+        return digits >= 7 && digits <= 15
+    }
+    //Without a country or area code, short numbers are more likely to be
+    //something else
+    return digits >= 9 && digits <= 15
+}
+
+//isCard checks a card number with the Luhn algorithm
+func isCard(match string) bool {
+    digits := nonDigits.ReplaceAllString(match, "")
+    sum := 0
+    for i := 0; i < len(digits); i++ {
+        digit := int(digits[len(digits)-1-i] - '0')
+        if i%2 == 1 {
+            digit *= 2
+            if digit > 9 {
+                digit -= 9
+            }
+        }
+        sum += digit
+    }
+    return sum%10 == 0
+}
+
+//isIBAN checks an IBAN's mod 97 check digits
+func isIBAN(match string) bool {
+    iban := strings.ToUpper(strings.Replace(match, " ", "", -1))
+    if len(iban) < 15 || len(iban) > 34 {
+        return false
+    }
+
+    //Move the country code and check digits to the end, and turn letters
+    //into numbers
+    var numeric strings.Builder
+    for _, r := range iban[4:] + iban[:4] {
+        if r >= 'A' && r <= 'Z' {
+            numeric.WriteString(strconv.Itoa(int(r - 'A' + 10)))
+        } else {
+            numeric.WriteRune(r)
+        }
+    }
+    n, ok := new(big.Int).SetString(numeric.String(), 10)
+    return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+func isIP(match string) bool {
+    return net.ParseIP(match) != nil
+}
+
+//hasSecrets reports whether a URL has a password, or a query parameter that
+//looks like a token
+func hasSecrets(match string) bool {
+    u, err := url.Parse(match)
+    if err != nil {
+        return false
+    }
+    if u.User != nil {
+        if _, hasPassword := u.User.Password(); hasPassword {
+            return true
+        }
+    }
+    //Some sites put tokens in the fragment instead of the query
+    fragment, _ := url.ParseQuery(u.Fragment)
+    for _, params := range []url.Values{u.Query(), fragment} {
+        for param := range params {
+            if secretParam.MatchString(param) {
+                return true
+            }
+        }
+    }
+    return false
+}
@@ -0,0 +1,48 @@
+package brain
+
+import (
+    "time"
+)
+
+//StopReason is why a brain stopped generating a reply
+type StopReason string
+
+const (
+    //StopEnd means the chain ended the reply, as a training message would
+    StopEnd StopReason = "end"
+    //StopLength means the reply reached the length limit
+    StopLength StopReason = "length"
+    //StopUnknown means the chain dead-ended, having never seen what came
+    //before
+    StopUnknown StopReason = "unknown ngram"
+    //StopFiltered means the next word was filtered out, such as profanity
+    StopFiltered StopReason = "filtered"
+    //StopNotNovel means every reply repeated too much of a training message,
+    //so the reply is empty and ErrNotNovel is returned
+    StopNotNovel StopReason = "not novel"
+)
+
+//Reply is a generated reply, along with how it was generated
+type Reply struct {
+    Text string
+    //Tokens are what the reply was generated as, before any slots were
+    //filled
+    Tokens  []string
+    Subject []string
+    //Probabilities are how likely each token was to be picked. Tokens the
+    //chain didn't pick, like the subject, have a probability of 1.
+    Probabilities []float64
+    StopReason    StopReason
+    Duration      time.Duration
+    //Trace is every step of generation, for replies from Explain
+    Trace *Trace `json:",omitempty"`
+}
+
+//Probability is how likely the whole reply was, given its subject
+func (reply Reply) Probability() float64 {
+    probability := 1.0
+    for _, p := range reply.Probabilities {
+        probability *= p
+    }
+    return probability
+}
@@ -0,0 +1,107 @@
+package brain
+
+import (
+    "strings"
+    "unicode"
+)
+
+//Words that are usually followed by a full stop without ending a sentence
+var abbreviations = map[string]bool{
+    "mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true,
+    "jr": true, "st": true, "vs": true, "etc": true, "e.g": true, "i.e": true,
+    "approx": true, "inc": true, "ltd": true, "co": true, "no": true,
+    "vol": true, "fig": true, "dept": true, "est": true, "min": true,
+    "max": true, "jan": true, "feb": true, "mar": true, "apr": true,
+    "jun": true, "jul": true, "aug": true, "sep": true, "sept": true,
+    "oct": true, "nov": true, "dec": true,
+}
+
+//SplitSentences splits text into its sentences. A sentence ends at a full
+//stop, question mark or exclamation mark followed by whitespace, unless the
+//full stop belongs to an abbreviation or initial. Ellipses and emoji only end
+//a sentence if the next one starts with a capital letter. Full stops inside
+//numbers, like 3.14, never end a sentence.
+func SplitSentences(text string) []string {
+    runes := []rune(text)
+    sentences := []string{}
+    start := 0
+    for i := 0; i < len(runes); i++ {
+        if !isTerminator(runes[i]) {
+            continue
+        }
+
+        //Take in the whole run of terminators, along with any closing
+        //quotes or brackets
+        end := i
+        for end+1 < len(runes) && (isTerminator(runes[end+1]) || isEmojiJoiner(runes[end+1]) || strings.ContainsRune(`"')]`, runes[end+1])) {
+            end++
+        }
+        next := end + 1
+        for next < len(runes) && unicode.IsSpace(runes[next]) {
+            next++
+        }
+        if next == end+1 || next == len(runes) || !endsSentence(runes[start:i], runes[i:end+1], runes[next]) {
+            i = end
+            continue
+        }
+
+        sentences = appendSentence(sentences, string(runes[start:end+1]))
+        start = next
+        i = next - 1
+    }
+    return appendSentence(sentences, string(runes[start:]))
+}
+
+func appendSentence(sentences []string, sentence string) []string {
+    sentence = strings.TrimSpace(sentence)
+    if sentence == "" {
+        return sentences
+    }
+    return append(sentences, sentence)
+}
+
+//endsSentence decides whether a run of terminators ends a sentence, given
+//the text before it and the first letter after it
+func endsSentence(before []rune, terminators []rune, next rune) bool {
+    dots := 0
+    for _, r := range terminators {
+        switch r {
+        case '!', '?':
+            return true
+        case '.':
+            dots++
+        case '…':
+            dots += 3
+        }
+    }
+
+    if dots != 1 {
+        //Ellipses and emoji are as likely to be a pause as an ending
+        return unicode.IsUpper(next)
+    }
+
+    fields := strings.Fields(string(before))
+    if len(fields) == 0 {
+        return true
+    }
+    word := strings.ToLower(strings.TrimLeft(fields[len(fields)-1], `"'([`))
+    if abbreviations[word] {
+        return false
+    }
+    //Initials, as in "J. R. R. Tolkien"
+    return len([]rune(word)) != 1 || !unicode.IsLetter([]rune(word)[0])
+}
+
+func isTerminator(r rune) bool {
+    return r == '.' || r == '!' || r == '?' || r == '…' || isEmoji(r)
+}
+
+func isEmoji(r rune) bool {
+    return (r >= 0x1F000 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF)
+}
+
+//isEmojiJoiner reports whether r glues emoji together, like zero width joiners
+//and variation selectors
+func isEmojiJoiner(r rune) bool {
+    return r == 0x200D || r == 0xFE0F
+}
@@ -0,0 +1,42 @@
+package brain
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	tables := []struct {
+		testcase string
+		input    string
+		expected []string
+	}{
+		{"Empty string", "", []string{}},
+		{"One sentence", "Test data", []string{"Test data"}},
+		{"Full stops", "Test data. Data test.", []string{"Test data.", "Data test."}},
+		{"Lower case", "test data. data test", []string{"test data.", "data test"}},
+		{"Questions and exclamations", "Test?! data! test", []string{"Test?!", "data!", "test"}},
+		{"Abbreviations", "Mr. Test met Dr. Data, e.g. at home. Then left", []string{"Mr. Test met Dr. Data, e.g. at home.", "Then left"}},
+		{"Initials", "J. R. R. Test wrote data. Then left", []string{"J. R. R. Test wrote data.", "Then left"}},
+		{"Decimals", "Test costs 3.50 now. Data is 2.5x more", []string{"Test costs 3.50 now.", "Data is 2.5x more"}},
+		{"Ellipsis, lower case", "test... data", []string{"test... data"}},
+		{"Ellipsis, upper case", "Test... Data", []string{"Test...", "Data"}},
+		{"Unicode ellipsis", "Test… Data", []string{"Test…", "Data"}},
+		{"Emoji, lower case", "I ❤️ data", []string{"I ❤️ data"}},
+		{"Emoji, upper case", "Test 😂 Data", []string{"Test 😂", "Data"}},
+		{"Full stop and emoji", "Test data.😂👍 then more", []string{"Test data.😂👍", "then more"}},
+		{"Closing quote", `He said "test." Data`, []string{`He said "test."`, "Data"}},
+		{"Newlines", "Test!\n\nData", []string{"Test!", "Data"}},
+		{"URL", "See test.com/data for more", []string{"See test.com/data for more"}},
+	}
+
+	for _, table := range tables {
+		t.Logf("Testing: %s", table.testcase)
+		got := SplitSentences(table.input)
+		if !reflect.DeepEqual(got, table.expected) {
+			t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+		} else {
+			t.Log("Passed")
+		}
+	}
+}
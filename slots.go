@@ -0,0 +1,75 @@
+package brain
+
+import (
+    "math/rand"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+//Placeholders in a generated reply, which may have been capitalised
+var slot = regexp.MustCompile(`<([A-Za-z][a-z]*)>`)
+
+//SlotFiller fills in a placeholder slot like <user>, given the slot's name
+//without the angle brackets. It returns false for slots it can't fill.
+type SlotFiller func(slot string) (string, bool)
+
+//SlotMap fills slots from a map of slot names to values
+func SlotMap(values map[string]string) SlotFiller {
+    return func(slot string) (string, bool) {
+        value, ok := values[slot]
+        return value, ok
+    }
+}
+
+//DefaultSlots fills slots with something generic, like "someone" for <user>
+//and a random number for <number>. Slots for redacted personal information
+//are filled with a vague description of it.
+func DefaultSlots(slot string) (string, bool) {
+    switch slot {
+    case "user":
+        return "someone", true
+    case "number":
+        return strconv.Itoa(rand.Intn(100) + 1), true
+    case string(RedactEmail):
+        return "my email", true
+    case string(RedactPhone):
+        return "my number", true
+    case string(RedactCard):
+        return "my card", true
+    case string(RedactIBAN):
+        return "my account", true
+    case string(RedactIP):
+        return "the server", true
+    case string(RedactURL):
+        return "the link", true
+    }
+    return "", false
+}
+
+//FillSlots fills every slot in reply with filler, falling back to
+//DefaultSlots for those it can't fill. Slots neither can fill are left as
+//they are. A slot capitalised at the start of a sentence gets a capitalised
+//value.
+func FillSlots(reply string, filler SlotFiller) string {
+    return slot.ReplaceAllStringFunc(reply, func(match string) string {
+        name := strings.ToLower(match[1 : len(match)-1])
+        value, ok := "", false
+        if filler != nil {
+            value, ok = filler(name)
+        }
+        if !ok {
+            value, ok = DefaultSlots(name)
+        }
+        if !ok {
+            return match
+        }
+
+        if first, size := utf8.DecodeRuneInString(value); unicode.IsUpper(rune(match[1])) && size > 0 {
+            value = string(unicode.ToUpper(first)) + value[size:]
+        }
+        return value
+    })
+}
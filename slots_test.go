@@ -0,0 +1,39 @@
+package brain
+
+import (
+    "regexp"
+    "testing"
+)
+
+func TestFillSlots(t *testing.T) {
+    tables := []struct {
+        testcase string
+        reply    string
+        filler   SlotFiller
+        expected string
+    }{
+        {"No slots", "Hello there", nil, "Hello there"},
+        {"From a map", "Hello <user>, see <url>", SlotMap(map[string]string{"user": "Alice", "url": "example.com"}), "Hello Alice, see example.com"},
+        {"From a callback", "Hi <user>", func(slot string) (string, bool) { return "bob", slot == "user" }, "Hi bob"},
+        {"Falls back to defaults", "Ask <user> for <email>", SlotMap(map[string]string{}), "Ask someone for my email"},
+        {"No filler", "Ask <user>", nil, "Ask someone"},
+        {"Capitalised", "<User> said hi. <Email> works", nil, "Someone said hi. My email works"},
+        {"Unknown slot", "Some <thing>", nil, "Some <thing>"},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        if got := FillSlots(table.reply, table.filler); got != table.expected {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestDefaultSlotsNumber(t *testing.T) {
+    got := FillSlots("I have <number> cats", nil)
+    if match, _ := regexp.MatchString(`^I have \d+ cats$`, got); !match {
+        t.Errorf("FAIL, expected a number, got: %#v", got)
+    }
+}
@@ -0,0 +1,119 @@
+package brain
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "text/tabwriter"
+)
+
+//TraceCandidates is how many of a step's candidates WriteTable lists. The
+//rest are only counted, to keep rows readable.
+const TraceCandidates = 5
+
+//Step is a single step in generating a reply: the context a chain was given,
+//the tokens that could have come next, and the one that was picked. Steps
+//that only have a Note record something else that happened, like a reply
+//being thrown away.
+type Step struct {
+    //Chain is which chain picked the token, for brains with more than one
+    Chain      string         `json:",omitempty"`
+    Context    []string       `json:",omitempty"`
+    Candidates map[string]int `json:",omitempty"`
+    Chosen     string         `json:",omitempty"`
+    Stop       StopReason     `json:",omitempty"`
+    Note       string         `json:",omitempty"`
+}
+
+//Trace records every step in generating a reply, to explain how it came
+//about. A nil trace records nothing.
+type Trace struct {
+    Steps []Step
+    lock  sync.Mutex
+}
+
+//Add records a step
+func (trace *Trace) Add(step Step) {
+    if trace == nil {
+        return
+    }
+    trace.lock.Lock()
+    defer trace.lock.Unlock()
+    trace.Steps = append(trace.Steps, step)
+}
+
+//Note records something that happened other than picking a token
+func (trace *Trace) Note(format string, args ...interface{}) {
+    trace.Add(Step{Note: fmt.Sprintf(format, args...)})
+}
+
+//JSON returns the trace as indented JSON, for bug reports
+func (trace *Trace) JSON() ([]byte, error) {
+    trace.lock.Lock()
+    defer trace.lock.Unlock()
+    return json.MarshalIndent(trace.Steps, "", "  ")
+}
+
+//WriteTable writes the trace to w as a table, one step per line, with
+//tokens quoted so that whitespace shows up. Candidates are listed most
+//likely first, up to TraceCandidates of them. JSON has them all.
+func (trace *Trace) WriteTable(w io.Writer) error {
+    trace.lock.Lock()
+    defer trace.lock.Unlock()
+
+    table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(table, "#\tChain\tContext\tCandidates\tChosen\tStop")
+    for i, step := range trace.Steps {
+        if step.Note != "" {
+            fmt.Fprintf(table, "%d\t%s\n", i+1, step.Note)
+            continue
+        }
+        fmt.Fprintf(table, "%d\t%s\t%s\t%s\t%s\t%s\n",
+            i+1,
+            step.Chain,
+            quoteAll(step.Context),
+            formatCandidates(step.Candidates),
+            strconv.Quote(step.Chosen),
+            step.Stop,
+        )
+    }
+    return table.Flush()
+}
+
+func quoteAll(tokens []string) string {
+    quoted := make([]string, len(tokens))
+    for i, token := range tokens {
+        quoted[i] = strconv.Quote(token)
+    }
+    return strings.Join(quoted, " ")
+}
+
+func formatCandidates(candidates map[string]int) string {
+    tokens := make([]string, 0, len(candidates))
+    for token := range candidates {
+        tokens = append(tokens, token)
+    }
+    sort.Slice(tokens, func(i, j int) bool {
+        if candidates[tokens[i]] != candidates[tokens[j]] {
+            return candidates[tokens[i]] > candidates[tokens[j]]
+        }
+        return tokens[i] < tokens[j]
+    })
+
+    shown := tokens
+    if len(shown) > TraceCandidates {
+        shown = shown[:TraceCandidates]
+    }
+    formatted := make([]string, len(shown))
+    for i, token := range shown {
+        formatted[i] = fmt.Sprintf("%s:%d", strconv.Quote(token), candidates[token])
+    }
+    if len(tokens) > len(shown) {
+        formatted = append(formatted, fmt.Sprintf("+%d more", len(tokens)-len(shown)))
+    }
+    return strings.Join(formatted, " ")
+}
@@ -0,0 +1,92 @@
+package brain
+
+import (
+    "bytes"
+    "encoding/json"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func testTrace() *Trace {
+    trace := new(Trace)
+    trace.Add(Step{Context: []string{"$"}, Candidates: map[string]int{"test": 1}, Chosen: "test"})
+    trace.Add(Step{Context: []string{"test"}, Candidates: map[string]int{" ": 1, "^": 3}, Chosen: "^", Stop: StopEnd})
+    trace.Note("Reply too short, resampling")
+    return trace
+}
+
+func TestTraceJSON(t *testing.T) {
+    trace := testTrace()
+    b, err := trace.JSON()
+    if err != nil {
+        t.Fatalf("FAIL, unexpected error: %v", err)
+    }
+
+    var got []Step
+    if err := json.Unmarshal(b, &got); err != nil {
+        t.Fatalf("FAIL, unable to unmarshal trace: %v", err)
+    }
+    if !reflect.DeepEqual(got, trace.Steps) {
+        t.Errorf("FAIL, expected: %#v, got: %#v", trace.Steps, got)
+    }
+}
+
+func TestTraceWriteTable(t *testing.T) {
+    var b bytes.Buffer
+    if err := testTrace().WriteTable(&b); err != nil {
+        t.Fatalf("FAIL, unexpected error: %v", err)
+    }
+    got := b.String()
+    t.Logf("Got:\n%s", got)
+
+    tables := []struct {
+        testcase string
+        expected string
+    }{
+        {"Header", "Context"},
+        {"Candidates by count", `"^":3 " ":1`},
+        {"Quoted tokens", `"test"`},
+        {"Stop reason", string(StopEnd)},
+        {"Note", "3  Reply too short, resampling"},
+    }
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        if !strings.Contains(got, table.expected) {
+            t.Errorf("FAIL, expected %#v in the table", table.expected)
+        }
+    }
+    if lines := strings.Count(got, "\n"); lines != 4 {
+        t.Errorf("FAIL, expected 4 lines, got: %d", lines)
+    }
+}
+
+func TestFormatCandidates(t *testing.T) {
+    tables := []struct {
+        testcase   string
+        candidates map[string]int
+        expected   string
+    }{
+        {"None", map[string]int{}, ""},
+        {"Ties", map[string]int{"b": 1, "a": 1}, `"a":1 "b":1`},
+        {"All shown", map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}, `"e":5 "d":4 "c":3 "b":2 "a":1`},
+        {"Capped", map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6, "g": 7}, `"g":7 "f":6 "e":5 "d":4 "c":3 +2 more`},
+    }
+
+    for _, table := range tables {
+        t.Logf("Testing: %s", table.testcase)
+        got := formatCandidates(table.candidates)
+        if got != table.expected {
+            t.Errorf("FAIL, expected: %#v, got: %#v", table.expected, got)
+        } else {
+            t.Log("Passed")
+        }
+    }
+}
+
+func TestTraceNil(t *testing.T) {
+    var trace *Trace
+    //Shouldn't panic
+    trace.Add(Step{Chosen: "test"})
+    trace.Note("test")
+}